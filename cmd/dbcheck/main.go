@@ -2,13 +2,25 @@ package main
 
 import (
 	"database/sql"
+	"flag"
 	"fmt"
 
+	"cotizaciones/internal/db"
+
 	_ "modernc.org/sqlite"
 )
 
 func main() {
-	db, err := sql.Open("sqlite", "/opt/osbo/datausd")
+	opts, err := db.OptionsFromEnv()
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	opts.ReadOnly = true
+	opts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	db, err := sql.Open("sqlite", opts.DSN())
 	if err != nil {
 		fmt.Println("Error:", err)
 		return
@@ -0,0 +1,277 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"cotizaciones/internal/archive"
+	"cotizaciones/internal/backup"
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/importer"
+	"cotizaciones/internal/ui"
+)
+
+const defaultBackupDir = "/opt/osbo/backups"
+
+// commands are the subcommands accepted as first argument; without one the
+// regular fetch/notify/export pipeline runs.
+var commands = map[string]func(dbOpts db.Options, args []string){
+	"backup":    runBackup,
+	"restore":   runRestore,
+	"import":    runImport,
+	"shift-utc": runShiftUTC,
+}
+
+// runBackup writes a snapshot of the database and rotates the old ones.
+func runBackup(dbOpts db.Options, args []string) {
+	opts := backup.Options{Dir: defaultBackupDir, KeepDaily: 7, KeepWeekly: 4}
+	if v := os.Getenv("BACKUP_DIR"); v != "" {
+		opts.Dir = v
+	}
+
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	dbOpts.RegisterFlags(fs)
+	fs.StringVar(&opts.Dir, "dir", opts.Dir, "directorio de snapshots (BACKUP_DIR)")
+	fs.BoolVar(&opts.Gzip, "gzip", opts.Gzip, "comprimir el snapshot con gzip")
+	fs.IntVar(&opts.KeepDaily, "keep-daily", opts.KeepDaily, "días con snapshot a conservar")
+	fs.IntVar(&opts.KeepWeekly, "keep-weekly", opts.KeepWeekly, "semanas con snapshot a conservar")
+	fs.Parse(args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ui.StepStart(1, 2, "🗄️", "Conectando a base de datos SQLite...")
+	database, err := db.New(dbOpts)
+	if err != nil {
+		exitWithError("Error abriendo base de datos: %v", err)
+	}
+	defer database.Close()
+	ui.Success(fmt.Sprintf("Conexión establecida → %s", dbOpts.Path))
+
+	ui.StepStart(2, 2, "💾", "Creando snapshot (VACUUM INTO)...")
+	path, removed, err := backup.Create(ctx, database, opts)
+	if path != "" {
+		ui.Success(fmt.Sprintf("Snapshot guardado → %s", path))
+	}
+	for _, r := range removed {
+		ui.Info(fmt.Sprintf("Snapshot rotado → %s", r))
+	}
+	if err != nil {
+		exitWithError("Error en backup: %v", err)
+	}
+
+	ui.Done()
+}
+
+// runRestore validates a snapshot and swaps it in place of the database.
+func runRestore(dbOpts db.Options, args []string) {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	dbOpts.RegisterFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: restore [flags] <snapshot.db|snapshot.db.gz>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if dbOpts.InMemory() {
+		exitWithError("No se puede restaurar sobre una base en memoria")
+	}
+	src := fs.Arg(0)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ui.StepStart(1, 1, "♻️", fmt.Sprintf("Restaurando %s → %s...", src, dbOpts.Path))
+	kept, err := backup.Restore(ctx, src, dbOpts.Path)
+	if err != nil {
+		exitWithError("Error restaurando snapshot: %v", err)
+	}
+	ui.Success("integrity_check ok, base reemplazada")
+	if kept != "" {
+		ui.Info(fmt.Sprintf("Base anterior conservada en %s", kept))
+	}
+
+	ui.Done()
+}
+
+// runImport loads historical cotizaciones from CSV or exported JSON files.
+func runImport(dbOpts db.Options, args []string) {
+	var (
+		format string
+		def    importer.Defaults
+		batch  int
+		strict bool
+	)
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	dbOpts.RegisterFlags(fs)
+	fs.StringVar(&format, "format", "", "csv o json (por defecto según la extensión)")
+	fs.StringVar(&def.Moneda, "moneda", "", "moneda para filas CSV sin columna moneda")
+	fs.StringVar(&def.Exchange, "exchange", "", "exchange para filas CSV sin columna exchange")
+	fs.StringVar(&def.Decimal, "decimal", "", "separador decimal de los CSV, . o , (por defecto se deduce de cada archivo)")
+	fs.IntVar(&batch, "batch", 500, "filas por transacción")
+	fs.BoolVar(&strict, "strict", false, "abortar si alguna fila es inválida")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: import [flags] <archivo.csv|archivo.json|archivo.ndjson.gz>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	total := fs.NArg() + 1
+	ui.StepStart(1, total, "🗄️", "Conectando a base de datos SQLite...")
+	database, err := db.New(dbOpts)
+	if err != nil {
+		exitWithError("Error abriendo base de datos: %v", err)
+	}
+	defer database.Close()
+	ui.Success(fmt.Sprintf("Conexión establecida → %s", dbOpts.Path))
+
+	for i, path := range fs.Args() {
+		ui.StepStart(i+2, total, "📥", fmt.Sprintf("Importando %s...", path))
+
+		rows, rowErrs, err := readImportFile(ctx, path, format, def)
+		if err != nil {
+			exitWithError("Error leyendo %s: %v", path, err)
+		}
+
+		for n, e := range rowErrs {
+			if n == 10 {
+				ui.Warn(fmt.Sprintf("... y %d filas inválidas más", len(rowErrs)-n))
+				break
+			}
+			ui.Warn(e.Error())
+		}
+		if len(rowErrs) > 0 && strict {
+			exitWithError("%s: %d filas inválidas, nada importado (-strict)", path, len(rowErrs))
+		}
+		ui.Info(fmt.Sprintf("%d filas válidas, %d inválidas", len(rows), len(rowErrs)))
+
+		res, err := database.ImportCotizaciones(ctx, rows, batch, func(r db.ImportResult) {
+			ui.Info(fmt.Sprintf("lote %d → %d/%d filas (%d nuevas, %d duplicadas, %d ya consolidadas)",
+				r.Batches, r.Processed, r.Total, r.Inserted, r.Duplicates, r.RolledUp))
+		})
+		if err != nil {
+			exitWithError("Error importando %s: %v", path, err)
+		}
+		ui.Success(fmt.Sprintf("%s: %d nuevas, %d duplicadas, %d ya consolidadas, %d inválidas",
+			path, res.Inserted, res.Duplicates, res.RolledUp, len(rowErrs)))
+	}
+
+	ui.Done()
+}
+
+// readImportFile reads the rows of one import file. Archive files
+// (*.ndjson.gz, see the archive package) already hold stored rows in UTC and
+// are streamed back as they are; anything else goes through importer.Read.
+func readImportFile(ctx context.Context, path, format string, def importer.Defaults) ([]db.Cotizacion, []importer.RowError, error) {
+	if format == "" && strings.HasSuffix(strings.ToLower(path), ".ndjson.gz") {
+		var rows []db.Cotizacion
+		err := archive.ReadFile(ctx, path, func(c db.Cotizacion) error {
+			rows = append(rows, c)
+			return nil
+		})
+		return rows, nil, err
+	}
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+	return importer.Read(file, format, def)
+}
+
+// runShiftUTC moves the rows written in local time before the switch to UTC.
+// It is a one-off conversion: only the range given with -from/-before (by
+// default everything before migration 0006) is touched, and without -apply the
+// rows are just counted. -mark records that those rows are already in UTC.
+func runShiftUTC(dbOpts db.Options, args []string) {
+	var (
+		offset       time.Duration
+		from, before string
+		apply, mark  bool
+	)
+	fs := flag.NewFlagSet("shift-utc", flag.ExitOnError)
+	dbOpts.RegisterFlags(fs)
+	fs.DurationVar(&offset, "offset", 0, "desplazamiento a sumar, en horas enteras (4h para hora de La Paz)")
+	fs.StringVar(&from, "from", "", "primer datetime guardado a desplazar (opcional)")
+	fs.StringVar(&before, "before", "", "primer datetime guardado ya en UTC; por defecto, cuando se aplicó la migración 0006")
+	fs.BoolVar(&apply, "apply", false, "aplicar el cambio; sin este flag solo se cuentan las filas")
+	fs.BoolVar(&mark, "mark", false, "solo registrar que las filas anteriores ya están en UTC, sin modificarlas")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Uso: shift-utc -offset 4h [-before '2025-03-01 12:00:00'] [-from ...] [-apply]")
+		fmt.Fprintln(fs.Output(), "     shift-utc -mark [-before ...]")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if offset == 0 && !mark || offset != 0 && mark || fs.NArg() != 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ui.StepStart(1, 2, "🗄️", "Conectando a base de datos SQLite...")
+	database, err := db.New(dbOpts)
+	if err != nil {
+		exitWithError("Error abriendo base de datos: %v", err)
+	}
+	defer database.Close()
+	ui.Success(fmt.Sprintf("Conexión establecida → %s", dbOpts.Path))
+
+	if before == "" {
+		if before, err = database.UTCCutoff(ctx); err != nil {
+			exitWithError("Error leyendo el paso a UTC: %v", err)
+		}
+	}
+
+	if mark {
+		ui.StepStart(2, 2, "🕓", fmt.Sprintf("Registrando como UTC los datetimes anteriores a %s...", before))
+		if err := database.MarkUTCShift(ctx, before); err != nil {
+			exitWithError("Error registrando: %v", err)
+		}
+		ui.Success("Registrado, sin filas modificadas")
+		ui.Done()
+		return
+	}
+
+	if from == "" {
+		ui.StepStart(2, 2, "🕓", fmt.Sprintf("Desplazando %s los datetimes anteriores a %s...", offset, before))
+	} else {
+		ui.StepStart(2, 2, "🕓", fmt.Sprintf("Desplazando %s los datetimes de %s a %s...", offset, from, before))
+	}
+	res, err := database.ShiftTimestamps(ctx, offset, from, before, !apply)
+	if err != nil {
+		exitWithError("Error desplazando timestamps: %v", err)
+	}
+	summary := fmt.Sprintf("%d cotizaciones, %d en cuarentena, %d notificaciones, %d buckets horarios",
+		res.Cotizaciones, res.Quarantine, res.Notifications, res.Hourly)
+	if !apply {
+		ui.Info("Simulación: " + summary)
+		ui.Warn("Nada modificado; haz un backup y repite con -apply")
+	} else {
+		ui.Success("Desplazados: " + summary)
+	}
+
+	ui.Done()
+}
@@ -0,0 +1,217 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+)
+
+const (
+	bcbURL      = "https://www.bcb.gob.bo/"
+	bcbExchange = "bcb"
+	// bcbWindow is how many characters after a label are searched for its values.
+	bcbWindow = 220
+	// bcbGap is how far a value may be from the label or key that announces it.
+	bcbGap = 40
+)
+
+// bcbRate describes how to locate one published rate in the BCB page text.
+type bcbRate struct {
+	Moneda  string // stored moneda
+	Label   string // lower-case, accent-free label that precedes the values
+	BuySell bool   // true: compra/venta pair; false: single value
+}
+
+// bcbRates are the rates read from the BCB page, in the order they are published.
+var bcbRates = []bcbRate{
+	{Moneda: instrument.USDOficial, Label: "tipo de cambio oficial", BuySell: true},
+	{Moneda: instrument.USDReferencial, Label: "valor referencial", BuySell: true},
+	{Moneda: instrument.EUR, Label: "euro", BuySell: true},
+	{Moneda: instrument.Oro, Label: "oro", BuySell: false},
+	{Moneda: instrument.Plata, Label: "plata", BuySell: false},
+	{Moneda: instrument.UFV, Label: "ufv", BuySell: false},
+}
+
+var (
+	bcbTagRe    = regexp.MustCompile(`(?s)<script.*?</script>|<style.*?</style>|<[^>]+>`)
+	bcbSpaceRe  = regexp.MustCompile(`\s+`)
+	bcbNumberRe = regexp.MustCompile(`\d[\d.,]*\d|\d`)
+	bcbDateRe   = regexp.MustCompile(`\bvigentes? (?:al|del|para el) (\d{2})/(\d{2})/(\d{4})\b`)
+	bcbKeyRe    = regexp.MustCompile(`\b(compra|venta)\b`)
+	bcbLabelRe  = labelsRe(bcbRates)
+	bcbAccents  = strings.NewReplacer("á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "Á", "a", "É", "e", "Í", "i", "Ó", "o", "Ú", "u")
+)
+
+// BCB fetches the official, referential, euro, gold, silver and UFV rates
+// published by the Banco Central de Bolivia.
+type BCB struct {
+	URL    string
+	Client *http.Client
+	Retry  RetryPolicy
+}
+
+// NewBCB creates a BCB fetcher for the public home page.
+func NewBCB() *BCB {
+	return &BCB{
+		URL:    bcbURL,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Retry:  DefaultRetry,
+	}
+}
+
+// Fetch downloads the BCB page and parses it into cotizaciones rows.
+// Venta is stored in Cotizacion and compra in Purchase, like the existing BCB rows.
+func (b *BCB) Fetch(ctx context.Context) ([]db.Cotizacion, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error building request: %w", err)
+	}
+
+	var page []byte
+	err = retry(ctx, b.Retry, func() (time.Duration, error) {
+		resp, err := b.Client.Do(req)
+		if err != nil {
+			return 0, fmt.Errorf("error fetching BCB: %w", err)
+		}
+		defer resp.Body.Close()
+		if wait, err := checkStatus(resp); err != nil {
+			return wait, err
+		}
+		page, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return 0, fmt.Errorf("error reading BCB page: %w", err)
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseBCB(string(page), time.Now())
+}
+
+// ParseBCB extracts the BCB rates from the HTML of the page. The publication date
+// is the "vigentes al dd/mm/yyyy" heading within bcbWindow characters before the
+// first rate label, or the day of now in La Paz if there is none: dates elsewhere
+// in the page (news, scripts) are ignored.
+// Each value must follow its own label (and compra/venta key) closely, so a
+// layout change makes it fail instead of reading the numbers of another rate;
+// every rate of bcbRates is required.
+func ParseBCB(page string, now time.Time) ([]db.Cotizacion, error) {
+	text := bcbSpaceRe.ReplaceAllString(html.UnescapeString(bcbTagRe.ReplaceAllString(page, " ")), " ")
+	text = strings.ToLower(bcbAccents.Replace(text))
+
+	date := now.In(db.Location).Format("2006-01-02")
+	if loc := bcbLabelRe.FindStringIndex(text); loc != nil {
+		head := text[max(0, loc[0]-bcbWindow):loc[0]]
+		if ms := bcbDateRe.FindAllStringSubmatch(head, -1); ms != nil {
+			m := ms[len(ms)-1]
+			date = m[3] + "-" + m[2] + "-" + m[1]
+		}
+	}
+
+	var out []db.Cotizacion
+	var missing []string
+	for _, r := range bcbRates {
+		idx := indexWord(text, r.Label)
+		if idx < 0 {
+			missing = append(missing, r.Moneda)
+			continue
+		}
+		// hasta la siguiente etiqueta: nunca leer los valores de otra tasa
+		window := text[idx+len(r.Label) : min(len(text), idx+len(r.Label)+bcbWindow)]
+		if loc := bcbLabelRe.FindStringIndex(window); loc != nil {
+			window = window[:loc[0]]
+		}
+
+		c := db.Cotizacion{Moneda: r.Moneda, Exchange: bcbExchange, SourceDatetime: date}
+		if r.BuySell {
+			compra, okC := valueAfter(window, "compra")
+			venta, okV := valueAfter(window, "venta")
+			if !okC || !okV {
+				missing = append(missing, r.Moneda)
+				continue
+			}
+			if compra > venta {
+				return nil, fmt.Errorf("BCB %s: compra %v above venta %v (layout changed?)", r.Moneda, compra, venta)
+			}
+			c.Cotizacion, c.Purchase = venta, compra
+		} else {
+			v, ok := leadingNumber(window)
+			if !ok {
+				missing = append(missing, r.Moneda)
+				continue
+			}
+			c.Cotizacion = v
+		}
+		out = append(out, c)
+	}
+
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("BCB rates not found in page (layout changed?): %s", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+// indexWord finds label as a whole word (so "oro" does not match "decoro").
+func indexWord(text, label string) int {
+	re := regexp.MustCompile(`\b` + regexp.QuoteMeta(label) + `\b`)
+	loc := re.FindStringIndex(text)
+	if loc == nil {
+		return -1
+	}
+	return loc[0]
+}
+
+// labelsRe matches any of the labels of rates as a whole word.
+func labelsRe(rates []bcbRate) *regexp.Regexp {
+	labels := make([]string, len(rates))
+	for i, r := range rates {
+		labels[i] = regexp.QuoteMeta(r.Label)
+	}
+	return regexp.MustCompile(`\b(` + strings.Join(labels, "|") + `)\b`)
+}
+
+// valueAfter returns the number that follows key inside window, before the
+// next compra/venta key.
+func valueAfter(window, key string) (float64, bool) {
+	loc := regexp.MustCompile(`\b` + key + `\b`).FindStringIndex(window)
+	if loc == nil {
+		return 0, false
+	}
+	rest := window[loc[1]:]
+	if next := bcbKeyRe.FindStringIndex(rest); next != nil {
+		rest = rest[:next[0]]
+	}
+	return leadingNumber(rest)
+}
+
+// leadingNumber returns the first number in s if it starts within bcbGap
+// characters, accepting Bolivian formatting ("6,96", "1.234,56") as well as "6.96".
+func leadingNumber(s string) (float64, bool) {
+	loc := bcbNumberRe.FindStringIndex(s)
+	if loc == nil || loc[0] > bcbGap {
+		return 0, false
+	}
+	v, ok := parseBoNumber(s[loc[0]:loc[1]])
+	return v, ok && v > 0
+}
+
+// parseBoNumber parses a number where ',' is the decimal separator if present.
+func parseBoNumber(s string) (float64, bool) {
+	if strings.Contains(s, ",") {
+		s = strings.ReplaceAll(s, ".", "")
+		s = strings.ReplaceAll(s, ",", ".")
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil
+}
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+)
+
+func readFixture(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestParseBCB(t *testing.T) {
+	home := readFixture(t, "bcb_home.html")
+	now := time.Date(2025, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	homeRates := []db.Cotizacion{
+		{Moneda: instrument.USDOficial, Cotizacion: 6.96, Purchase: 6.86},
+		{Moneda: instrument.USDReferencial, Cotizacion: 7.18, Purchase: 6.97},
+		{Moneda: instrument.EUR, Cotizacion: 7.61, Purchase: 7.45},
+		{Moneda: instrument.Oro, Cotizacion: 2936.45},
+		{Moneda: instrument.Plata, Cotizacion: 32.87},
+		{Moneda: instrument.UFV, Cotizacion: 2.56843},
+	}
+
+	tests := []struct {
+		name    string
+		page    string
+		now     time.Time // zero: now
+		date    string
+		want    []db.Cotizacion
+		wantErr string
+	}{
+		{
+			name: "home page",
+			page: home,
+			date: "2025-03-14",
+			want: homeRates,
+		},
+		{
+			name: "dot decimals and no date",
+			page: strings.NewReplacer("Vigentes al 14/03/2025", "", "Publicado el 14/03/2025.", "",
+				"6,86", "6.86", "6,96", "6.96", "2,56843", "2.56843").Replace(home),
+			date: "2025-03-15",
+			want: homeRates,
+		},
+		{
+			// la fecha de una noticia no es la de publicación de las tasas
+			name: "news date before the rates",
+			page: strings.Replace(home, "Publicado el 14/03/2025.", "Publicado el 01/03/2025.", 1),
+			date: "2025-03-14",
+			want: homeRates,
+		},
+		{
+			name: "only a news date",
+			page: strings.Replace(home, "Vigentes al 14/03/2025", "", 1),
+			date: "2025-03-15",
+			want: homeRates,
+		},
+		{
+			// 22:00 en La Paz: todavía es el día anterior al de UTC
+			name: "no date, late evening in La Paz",
+			page: strings.Replace(strings.Replace(home, "Vigentes al 14/03/2025", "", 1), "Publicado el 14/03/2025.", "", 1),
+			now:  time.Date(2025, 3, 16, 2, 0, 0, 0, time.UTC),
+			date: "2025-03-15",
+			want: homeRates,
+		},
+		{
+			name:    "compra/venta moved to a header row",
+			page:    readFixture(t, "bcb_layout_changed.html"),
+			wantErr: "usd oficial, usd referencial, eur",
+		},
+		{
+			// antes se leía el valor de la UFV como precio de la plata
+			name:    "rate without value",
+			page:    strings.Replace(home, "$us 32,87", "no disponible", 1),
+			wantErr: "plata",
+		},
+		{
+			name:    "venta missing",
+			page:    strings.Replace(home, "<tr><td>Venta</td><td>7,61</td></tr>", "", 1),
+			wantErr: "eur",
+		},
+		{
+			name:    "compra above venta",
+			page:    strings.Replace(home, "<td>6,97</td>", "<td>7,97</td>", 1),
+			wantErr: "compra 7.97 above venta 7.18",
+		},
+		{
+			name:    "value far from its label",
+			page:    strings.Replace(home, "<td>2,56843</td>", "<td>ver boletín diario del día anterior publicado</td><td>2,56843</td>", 1),
+			wantErr: "ufv",
+		},
+		{
+			name:    "empty page",
+			page:    "<html><body>Sitio en mantenimiento</body></html>",
+			wantErr: "usd oficial, usd referencial, eur, oro, plata, ufv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at := tt.now
+			if at.IsZero() {
+				at = now
+			}
+			got, err := ParseBCB(tt.page, at)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v (%+v), want error mentioning %q", err, got, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d rates, want %d: %+v", len(got), len(tt.want), got)
+			}
+			for i, w := range tt.want {
+				w.Exchange, w.SourceDatetime = bcbExchange, tt.date
+				if got[i] != w {
+					t.Errorf("rate %d: got %+v, want %+v", i, got[i], w)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const binanceP2PSearchURL = "https://p2p.binance.com/bapi/c2c/v2/friendly/c2c/adv/search"
+
+// PriceMethod selects how the advert prices are reduced to a single value.
+type PriceMethod int
+
+const (
+	// TrimmedMean averages the top N prices after discarding TrimPct from each end.
+	TrimmedMean PriceMethod = iota
+	// Median takes the median of the top N prices.
+	Median
+)
+
+// BinanceP2P is a QuoteSource that reads Binance P2P advert search results
+// directly instead of relying on an aggregator.
+type BinanceP2P struct {
+	URL          string
+	Asset        string
+	Fiat         string
+	PayTypes     []string // payment method identifiers, e.g. "BancoUnion"; empty means any
+	MinAmount    float64  // only adverts that accept a trade of this fiat amount
+	MerchantOnly bool     // only adverts published by verified merchants
+	TopN         int      // number of best adverts considered per side
+	TrimPct      float64  // fraction discarded from each end for TrimmedMean, e.g. 0.1
+	Method       PriceMethod
+	Client       *http.Client
+	Retry        RetryPolicy
+}
+
+// NewBinanceP2P creates a Binance P2P source with sensible defaults for the given pair.
+func NewBinanceP2P(asset, fiat string) *BinanceP2P {
+	return &BinanceP2P{
+		URL:     binanceP2PSearchURL,
+		Asset:   asset,
+		Fiat:    fiat,
+		TopN:    10,
+		TrimPct: 0.1,
+		Method:  TrimmedMean,
+		Client:  &http.Client{Timeout: 15 * time.Second},
+		Retry:   DefaultRetry,
+	}
+}
+
+// Name returns the exchange identifier stored for these quotes.
+func (b *BinanceP2P) Name() string { return "binancep2p_adv" }
+
+// Instrument returns the quoted asset.
+func (b *BinanceP2P) Instrument() string { return b.Asset }
+
+// binanceSearchRequest is the body accepted by the advert search endpoint.
+type binanceSearchRequest struct {
+	Asset         string   `json:"asset"`
+	Fiat          string   `json:"fiat"`
+	TradeType     string   `json:"tradeType"`
+	Page          int      `json:"page"`
+	Rows          int      `json:"rows"`
+	PayTypes      []string `json:"payTypes"`
+	PublisherType *string  `json:"publisherType"`
+	TransAmount   string   `json:"transAmount,omitempty"`
+}
+
+// BinanceSearchResponse represents the advert search response.
+type BinanceSearchResponse struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message"`
+	Success bool            `json:"success"`
+	Data    []BinanceAdvert `json:"data"`
+}
+
+// BinanceAdvert is a single advert of the search response.
+type BinanceAdvert struct {
+	Adv struct {
+		Price                string               `json:"price"`
+		MinSingleTransAmount string               `json:"minSingleTransAmount"`
+		MaxSingleTransAmount string               `json:"maxSingleTransAmount"`
+		TradeMethods         []BinanceTradeMethod `json:"tradeMethods"`
+	} `json:"adv"`
+	Advertiser struct {
+		NickName string `json:"nickName"`
+		UserType string `json:"userType"`
+	} `json:"advertiser"`
+}
+
+// BinanceTradeMethod is a payment method accepted by an advert.
+type BinanceTradeMethod struct {
+	Identifier string `json:"identifier"`
+}
+
+// Fetch queries both sides of the book and returns a single quote where the ask
+// comes from BUY adverts (what a user pays) and the bid from SELL adverts.
+func (b *BinanceP2P) Fetch(ctx context.Context) ([]Quote, error) {
+	ask, err := b.side(ctx, "BUY")
+	if err != nil {
+		return nil, fmt.Errorf("BUY: %w", err)
+	}
+	bid, err := b.side(ctx, "SELL")
+	if err != nil {
+		return nil, fmt.Errorf("SELL: %w", err)
+	}
+
+	return []Quote{{
+		Moneda:   b.Asset,
+		Exchange: b.Name(),
+		Ask:      ask,
+		TotalAsk: ask,
+		Bid:      bid,
+		TotalBid: bid,
+		Time:     time.Now().Unix(),
+	}}, nil
+}
+
+// side fetches one trade type and reduces the filtered advert prices to one value.
+func (b *BinanceP2P) side(ctx context.Context, tradeType string) (float64, error) {
+	body := binanceSearchRequest{
+		Asset:     b.Asset,
+		Fiat:      b.Fiat,
+		TradeType: tradeType,
+		Page:      1,
+		Rows:      20,
+		PayTypes:  b.PayTypes,
+	}
+	if body.PayTypes == nil {
+		body.PayTypes = []string{}
+	}
+	if b.MerchantOnly {
+		merchant := "merchant"
+		body.PublisherType = &merchant
+	}
+	if b.MinAmount > 0 {
+		body.TransAmount = strconv.FormatFloat(b.MinAmount, 'f', -1, 64)
+	}
+
+	var resp BinanceSearchResponse
+	if err := postJSON(ctx, b.Client, b.Retry, b.URL, body, &resp); err != nil {
+		return 0, err
+	}
+	if !resp.Success {
+		return 0, fmt.Errorf("API returned code %s: %s", resp.Code, resp.Message)
+	}
+
+	prices := b.filter(resp.Data)
+	if len(prices) == 0 {
+		return 0, fmt.Errorf("no adverts match the filters")
+	}
+
+	// BUY: los más baratos primero; SELL: los que más pagan primero.
+	slices.Sort(prices)
+	if tradeType == "SELL" {
+		slices.Reverse(prices)
+	}
+	if b.TopN > 0 && len(prices) > b.TopN {
+		prices = prices[:b.TopN]
+	}
+
+	if b.Method == Median {
+		return median(prices), nil
+	}
+	return trimmedMean(prices, b.TrimPct), nil
+}
+
+// filter applies the payment method, amount and merchant filters locally (the
+// endpoint does not always honor them) and returns the usable prices.
+func (b *BinanceP2P) filter(adverts []BinanceAdvert) []float64 {
+	var prices []float64
+	for _, a := range adverts {
+		price, err := strconv.ParseFloat(a.Adv.Price, 64)
+		if err != nil || price <= 0 {
+			continue
+		}
+		if b.MerchantOnly && a.Advertiser.UserType != "merchant" {
+			continue
+		}
+		if b.MinAmount > 0 {
+			lo, _ := strconv.ParseFloat(a.Adv.MinSingleTransAmount, 64)
+			hi, _ := strconv.ParseFloat(a.Adv.MaxSingleTransAmount, 64)
+			if b.MinAmount < lo || (hi > 0 && b.MinAmount > hi) {
+				continue
+			}
+		}
+		if len(b.PayTypes) > 0 && !slices.ContainsFunc(a.Adv.TradeMethods, func(m BinanceTradeMethod) bool {
+			return slices.Contains(b.PayTypes, m.Identifier)
+		}) {
+			continue
+		}
+		prices = append(prices, price)
+	}
+	return prices
+}
+
+// median returns the median of values (len > 0).
+func median(values []float64) float64 {
+	s := slices.Clone(values)
+	slices.Sort(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// trimmedMean discards pct of the values from each end and averages the rest (len > 0).
+func trimmedMean(values []float64, pct float64) float64 {
+	s := slices.Clone(values)
+	slices.Sort(s)
+	k := int(float64(len(s)) * pct)
+	if 2*k >= len(s) {
+		k = (len(s) - 1) / 2
+	}
+	s = s[k : len(s)-k]
+	var sum float64
+	for _, v := range s {
+		sum += v
+	}
+	return sum / float64(len(s))
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// binanceServer serves the recorded advert pages of testdata by tradeType and
+// keeps the request bodies it received.
+func binanceServer(t *testing.T) (*httptest.Server, func() []binanceSearchRequest) {
+	t.Helper()
+	pages := map[string][]byte{}
+	for tradeType, name := range map[string]string{"BUY": "binance_buy.json", "SELL": "binance_sell.json"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages[tradeType] = data
+	}
+
+	var mu sync.Mutex
+	var reqs []binanceSearchRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req binanceSearchRequest
+		if r.Method != http.MethodPost || json.NewDecoder(r.Body).Decode(&req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		reqs = append(reqs, req)
+		mu.Unlock()
+
+		page, ok := pages[req.TradeType]
+		if !ok {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(page)
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, func() []binanceSearchRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return reqs
+	}
+}
+
+func TestBinanceP2PFetch(t *testing.T) {
+	// testdata: BUY 10.05 10.08 10.10 10.12 10.15 10.20 10.25 (7 anuncios),
+	// SELL 9.95 9.92 9.90 9.88 9.85 9.80 (6 anuncios).
+	tests := []struct {
+		name     string
+		setup    func(*BinanceP2P)
+		ask, bid float64
+	}{
+		{
+			name:  "median odd BUY, even SELL",
+			setup: func(b *BinanceP2P) { b.Method = Median },
+			ask:   10.12,
+			bid:   (9.90 + 9.88) / 2,
+		},
+		{
+			name:  "trimmed mean odd BUY, even SELL",
+			setup: func(b *BinanceP2P) { b.TrimPct = 0.2 }, // descarta 1 por extremo
+			ask:   (10.08 + 10.10 + 10.12 + 10.15 + 10.20) / 5,
+			bid:   (9.92 + 9.90 + 9.88 + 9.85) / 4,
+		},
+		{
+			name:  "top N keeps the best adverts of each side",
+			setup: func(b *BinanceP2P) { b.Method, b.TopN = Median, 3 },
+			ask:   10.08,
+			bid:   9.92,
+		},
+		{
+			name:  "payment method",
+			setup: func(b *BinanceP2P) { b.Method, b.PayTypes = Median, []string{"BancoBisa"} },
+			ask:   10.10, // 10.08 10.10 10.25
+			bid:   9.92,
+		},
+		{
+			name:  "min amount",
+			setup: func(b *BinanceP2P) { b.Method, b.MinAmount = Median, 1800 },
+			ask:   (10.10 + 10.12) / 2, // sin 10.25 (máx 1500)
+			bid:   (9.92 + 9.85) / 2,   // sin 9.90 (mín 2000) ni 9.88 (máx 800)
+		},
+		{
+			name:  "merchant only",
+			setup: func(b *BinanceP2P) { b.Method, b.MerchantOnly = Median, true },
+			ask:   10.15,             // 10.05 10.10 10.15 10.20 10.25
+			bid:   (9.88 + 9.85) / 2, // 9.95 9.88 9.85 9.80
+		},
+		{
+			name: "all filters",
+			setup: func(b *BinanceP2P) {
+				b.Method, b.PayTypes, b.MinAmount, b.MerchantOnly = Median, []string{"BancoUnion"}, 1000, true
+			},
+			ask: (10.05 + 10.10) / 2, // sin 10.12 (user) ni 10.20 (mín 1500)
+			bid: (9.95 + 9.80) / 2,   // sin 9.90 (user) ni 9.88 (máx 800)
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, _ := binanceServer(t)
+			b := NewBinanceP2P("USDT", "BOB")
+			b.URL, b.Client = srv.URL, srv.Client()
+			tt.setup(b)
+
+			quotes, err := b.Fetch(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(quotes) != 1 {
+				t.Fatalf("got %d quotes, want 1", len(quotes))
+			}
+			q := quotes[0]
+			if q.Moneda != "USDT" || q.Exchange != "binancep2p_adv" {
+				t.Errorf("got %s/%s, want USDT/binancep2p_adv", q.Moneda, q.Exchange)
+			}
+			if !approx(q.Ask, tt.ask) || !approx(q.TotalAsk, tt.ask) {
+				t.Errorf("ask %v / %v, want %v", q.Ask, q.TotalAsk, tt.ask)
+			}
+			if !approx(q.Bid, tt.bid) || !approx(q.TotalBid, tt.bid) {
+				t.Errorf("bid %v / %v, want %v", q.Bid, q.TotalBid, tt.bid)
+			}
+		})
+	}
+}
+
+func TestBinanceP2PRequestCarriesFilters(t *testing.T) {
+	srv, requests := binanceServer(t)
+	b := NewBinanceP2P("USDT", "BOB")
+	b.URL, b.Client = srv.URL, srv.Client()
+	b.PayTypes, b.MinAmount, b.MerchantOnly = []string{"BancoUnion"}, 1000, true
+
+	if _, err := b.Fetch(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	reqs := requests()
+	if len(reqs) != 2 || reqs[0].TradeType != "BUY" || reqs[1].TradeType != "SELL" {
+		t.Fatalf("got %+v, want a BUY and a SELL search", reqs)
+	}
+	for _, r := range reqs {
+		if r.Asset != "USDT" || r.Fiat != "BOB" || r.TransAmount != "1000" ||
+			len(r.PayTypes) != 1 || r.PayTypes[0] != "BancoUnion" ||
+			r.PublisherType == nil || *r.PublisherType != "merchant" {
+			t.Errorf("%s request does not carry the filters: %+v", r.TradeType, r)
+		}
+	}
+}
+
+func TestBinanceP2PNoMatchingAdverts(t *testing.T) {
+	srv, _ := binanceServer(t)
+	b := NewBinanceP2P("USDT", "BOB")
+	b.URL, b.Client = srv.URL, srv.Client()
+	b.PayTypes = []string{"TigoMoney"}
+
+	if _, err := b.Fetch(context.Background()); err == nil {
+		t.Fatal("expected an error when no advert matches the filters")
+	}
+}
+
+func TestMedianAndTrimmedMean(t *testing.T) {
+	tests := []struct {
+		values        []float64
+		pct           float64
+		median, trimd float64
+	}{
+		{[]float64{3}, 0.1, 3, 3},
+		{[]float64{4, 1}, 0.5, 2.5, 2.5},
+		{[]float64{5, 1, 3}, 0.34, 3, 3},
+		{[]float64{10, 1, 2, 3}, 0.25, 2.5, 2.5},
+		{[]float64{1, 2, 3, 4, 100}, 0.2, 3, 3},
+		{[]float64{1, 2, 3, 4, 5, 100}, 0.1, 3.5, 115.0 / 6},
+	}
+	for _, tt := range tests {
+		if got := median(tt.values); !approx(got, tt.median) {
+			t.Errorf("median(%v) = %v, want %v", tt.values, got, tt.median)
+		}
+		if got := trimmedMean(tt.values, tt.pct); !approx(got, tt.trimd) {
+			t.Errorf("trimmedMean(%v, %v) = %v, want %v", tt.values, tt.pct, got, tt.trimd)
+		}
+	}
+}
+
+func approx(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
@@ -1,13 +1,14 @@
 package api
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"net/http"
+	"sort"
 	"time"
 )
 
-const apiURL = "https://criptoya.com/api/binancep2p/USDT/BOB"
+const criptoYaBaseURL = "https://criptoya.com/api"
 
 // CriptoYaResponse represents the API response from criptoya.com
 type CriptoYaResponse struct {
@@ -18,24 +19,112 @@ type CriptoYaResponse struct {
 	Time     int64   `json:"time"`
 }
 
-// FetchCotizacion fetches the current USDT/BOB quote from CriptoYa API
-func FetchCotizacion() (*CriptoYaResponse, error) {
-	client := &http.Client{Timeout: 15 * time.Second}
+// CriptoYa is a QuoteSource for a single exchange/coin/fiat on criptoya.com
+type CriptoYa struct {
+	URL      string
+	Exchange string
+	Coin     string
+	Fiat     string
+	Client   *http.Client
+	Retry    RetryPolicy
+}
 
-	resp, err := client.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("error fetching API: %w", err)
+// NewCriptoYa creates a CriptoYa source for the given exchange and pair.
+func NewCriptoYa(exchange, coin, fiat string) *CriptoYa {
+	return &CriptoYa{
+		URL:      fmt.Sprintf("%s/%s/%s/%s", criptoYaBaseURL, exchange, coin, fiat),
+		Exchange: exchange,
+		Coin:     coin,
+		Fiat:     fiat,
+		Client:   &http.Client{Timeout: 15 * time.Second},
+		Retry:    DefaultRetry,
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned status %d", resp.StatusCode)
-	}
+// Name returns the exchange identifier.
+func (c *CriptoYa) Name() string { return c.Exchange }
 
+// Instrument returns the quoted coin.
+func (c *CriptoYa) Instrument() string { return c.Coin }
+
+// Fetch fetches the current quote from CriptoYa API
+func (c *CriptoYa) Fetch(ctx context.Context) ([]Quote, error) {
 	var data CriptoYaResponse
-	if err := json.NewDecoder(resp.Body).Decode(&data); err != nil {
-		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	if err := getJSON(ctx, c.Client, c.Retry, c.URL, &data); err != nil {
+		return nil, err
+	}
+
+	return []Quote{{
+		Moneda:   c.Coin,
+		Exchange: c.Exchange,
+		Ask:      data.Ask,
+		TotalAsk: data.TotalAsk,
+		Bid:      data.Bid,
+		TotalBid: data.TotalBid,
+		Time:     data.Time,
+	}}, nil
+}
+
+// CriptoYaAll is a QuoteSource for the multi-exchange endpoint of criptoya.com,
+// which returns the same coin/fiat pair quoted on every supported exchange.
+type CriptoYaAll struct {
+	URL    string
+	Coin   string
+	Fiat   string
+	Client *http.Client
+	Retry  RetryPolicy
+}
+
+// NewCriptoYaAll creates a multi-exchange CriptoYa source for the given pair.
+func NewCriptoYaAll(coin, fiat string) *CriptoYaAll {
+	return &CriptoYaAll{
+		URL:    fmt.Sprintf("%s/%s/%s/1", criptoYaBaseURL, coin, fiat),
+		Coin:   coin,
+		Fiat:   fiat,
+		Client: &http.Client{Timeout: 15 * time.Second},
+		Retry:  DefaultRetry,
+	}
+}
+
+// Name returns the aggregator identifier; each quote carries its own exchange.
+func (c *CriptoYaAll) Name() string { return "criptoya" }
+
+// Instrument returns the quoted coin.
+func (c *CriptoYaAll) Instrument() string { return c.Coin }
+
+// Fetch returns one quote per exchange, skipping exchanges without prices.
+func (c *CriptoYaAll) Fetch(ctx context.Context) ([]Quote, error) {
+	var data map[string]CriptoYaResponse
+	if err := getJSON(ctx, c.Client, c.Retry, c.URL, &data); err != nil {
+		return nil, err
+	}
+
+	exchanges := make([]string, 0, len(data))
+	for ex := range data {
+		exchanges = append(exchanges, ex)
+	}
+	sort.Strings(exchanges)
+
+	quotes := make([]Quote, 0, len(exchanges))
+	for _, ex := range exchanges {
+		r := data[ex]
+		if r.Bid <= 0 && r.TotalAsk <= 0 {
+			continue
+		}
+		quotes = append(quotes, Quote{
+			Moneda:   c.Coin,
+			Exchange: ex,
+			Ask:      r.Ask,
+			TotalAsk: r.TotalAsk,
+			Bid:      r.Bid,
+			TotalBid: r.TotalBid,
+			Time:     r.Time,
+		})
+	}
+
+	if len(quotes) == 0 {
+		return nil, fmt.Errorf("API returned no exchanges for %s/%s", c.Coin, c.Fiat)
 	}
 
-	return &data, nil
+	return quotes, nil
 }
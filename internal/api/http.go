@@ -0,0 +1,208 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how many times and how fast a failed request is retried.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts including the first one
+	BaseDelay   time.Duration // delay before the first retry, doubled on every attempt
+	MaxDelay    time.Duration // upper bound for a single wait (backoff or Retry-After)
+}
+
+// DefaultRetry is the policy used by the sources unless overridden.
+var DefaultRetry = RetryPolicy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    10 * time.Second,
+}
+
+// RateLimitError is returned when the API answers 429 or 503 and the retries are exhausted
+// (or the requested Retry-After exceeds the policy's MaxDelay).
+type RateLimitError struct {
+	StatusCode int
+	RetryAfter time.Duration // zero if the server did not send Retry-After
+}
+
+func (e *RateLimitError) Error() string {
+	if e.RetryAfter > 0 {
+		return fmt.Sprintf("API rate limited (status %d, retry after %s)", e.StatusCode, e.RetryAfter)
+	}
+	return fmt.Sprintf("API rate limited (status %d)", e.StatusCode)
+}
+
+// StatusError is returned when the API answers an unexpected HTTP status.
+type StatusError struct {
+	StatusCode int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API returned status %d", e.StatusCode)
+}
+
+// DecodeError is returned when the response body is not the expected JSON.
+type DecodeError struct {
+	Err error
+}
+
+func (e *DecodeError) Error() string { return fmt.Sprintf("error parsing JSON: %v", e.Err) }
+func (e *DecodeError) Unwrap() error { return e.Err }
+
+// Retryable reports whether err is a transient failure worth retrying later:
+// rate limits, 5xx statuses and network errors, timeouts included. Decode
+// errors, 4xx statuses and cancellation are not retryable. A deadline is not
+// judged here: http.Client.Timeout also wraps context.DeadlineExceeded, so
+// whether the caller gave up is decided from its context (see retry).
+func Retryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var rl *RateLimitError
+	if errors.As(err, &rl) {
+		return true
+	}
+	var se *StatusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= 500
+	}
+	var de *DecodeError
+	return !errors.As(err, &de)
+}
+
+// getJSON performs a GET request against url and decodes the JSON body into v,
+// retrying transient failures according to policy.
+func getJSON(ctx context.Context, client *http.Client, policy RetryPolicy, url string, v any) error {
+	return doJSON(ctx, client, policy, http.MethodGet, url, nil, v)
+}
+
+// postJSON sends body as a JSON POST request and decodes the JSON response into v,
+// retrying transient failures according to policy.
+func postJSON(ctx context.Context, client *http.Client, policy RetryPolicy, url string, body, v any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error encoding request: %w", err)
+	}
+	return doJSON(ctx, client, policy, http.MethodPost, url, payload, v)
+}
+
+// doJSON performs the request with retries. payload is resent on every attempt.
+func doJSON(ctx context.Context, client *http.Client, policy RetryPolicy, method, url string, payload []byte, v any) error {
+	return retry(ctx, policy, func() (time.Duration, error) {
+		return doJSONOnce(ctx, client, method, url, payload, v)
+	})
+}
+
+// retry calls attempt until it succeeds, fails with a non-retryable error or the
+// policy is exhausted. attempt returns the server's Retry-After hint, if any.
+func retry(ctx context.Context, policy RetryPolicy, attempt func() (time.Duration, error)) error {
+	attempts := max(policy.MaxAttempts, 1)
+
+	var err error
+	for n := 1; ; n++ {
+		var wait time.Duration
+		wait, err = attempt()
+		if err == nil || n >= attempts || ctx.Err() != nil || !Retryable(err) {
+			return err
+		}
+
+		if wait == 0 {
+			wait = backoff(policy, n)
+		} else if wait > policy.MaxDelay {
+			// El servidor pide esperar más de lo permitido: dejamos que decida el llamador.
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
+
+// doJSONOnce performs a single attempt. The returned duration is the server's
+// Retry-After hint, if any.
+func doJSONOnce(ctx context.Context, client *http.Client, method, url string, payload []byte, v any) (time.Duration, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return 0, fmt.Errorf("error building request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("error fetching API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if wait, err := checkStatus(resp); err != nil {
+		return wait, err
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return 0, &DecodeError{Err: err}
+	}
+
+	return 0, nil
+}
+
+// checkStatus maps a non-200 response to a typed error, returning the Retry-After hint
+// for rate limits.
+func checkStatus(resp *http.Response) (time.Duration, error) {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		wait := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return wait, &RateLimitError{StatusCode: resp.StatusCode, RetryAfter: wait}
+	case resp.StatusCode != http.StatusOK:
+		return 0, &StatusError{StatusCode: resp.StatusCode}
+	}
+	return 0, nil
+}
+
+// backoff returns the exponential delay for the given attempt with jitter in [d/2, d].
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	d := policy.BaseDelay << (attempt - 1)
+	if d <= 0 || d > policy.MaxDelay {
+		d = policy.MaxDelay
+	}
+	if d <= 1 {
+		return d
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,246 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetry keeps the tests quick while still exercising every retry.
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 2 * time.Second}
+
+// scripted serves the given handlers in order, repeating the last one, and
+// counts the requests received.
+func scripted(t *testing.T, handlers ...http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		handlers[min(n, len(handlers)-1)](w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func status(code int, retryAfter string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if retryAfter != "" {
+			w.Header().Set("Retry-After", retryAfter)
+		}
+		w.WriteHeader(code)
+	}
+}
+
+func body(s string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(s))
+	}
+}
+
+// slow answers after d, past the client timeout of the tests that use it.
+func slow(d time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+		}
+		w.Write([]byte(`{}`))
+	}
+}
+
+func TestGetJSONRetriesRateLimitHonoringRetryAfter(t *testing.T) {
+	for _, code := range []int{http.StatusTooManyRequests, http.StatusServiceUnavailable} {
+		srv, calls := scripted(t, status(code, "1"), body(`{"bid": 9.5}`))
+
+		var v struct{ Bid float64 }
+		start := time.Now()
+		if err := getJSON(context.Background(), srv.Client(), fastRetry, srv.URL, &v); err != nil {
+			t.Fatalf("%d: unexpected error: %v", code, err)
+		}
+		if elapsed := time.Since(start); elapsed < time.Second {
+			t.Errorf("%d: retried after %s, want at least the 1s of Retry-After", code, elapsed)
+		}
+		if v.Bid != 9.5 || calls.Load() != 2 {
+			t.Errorf("%d: bid %v after %d calls, want 9.5 after 2", code, v.Bid, calls.Load())
+		}
+	}
+}
+
+func TestGetJSONRetryAfterBeyondMaxDelay(t *testing.T) {
+	srv, calls := scripted(t, status(http.StatusTooManyRequests, "3600"))
+
+	var v any
+	err := getJSON(context.Background(), srv.Client(), fastRetry, srv.URL, &v)
+	var rl *RateLimitError
+	if !errors.As(err, &rl) {
+		t.Fatalf("got %v, want *RateLimitError", err)
+	}
+	if rl.StatusCode != http.StatusTooManyRequests || rl.RetryAfter != time.Hour {
+		t.Errorf("got %+v, want status 429 and RetryAfter 1h", rl)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1: a wait above MaxDelay is left to the caller", calls.Load())
+	}
+}
+
+func TestGetJSONTypedErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		calls     int32
+		retryable bool
+		check     func(error) bool
+	}{
+		{
+			name:      "rate limit exhausted",
+			handler:   status(http.StatusServiceUnavailable, ""),
+			calls:     3,
+			retryable: true,
+			check: func(err error) bool {
+				var e *RateLimitError
+				return errors.As(err, &e) && e.StatusCode == http.StatusServiceUnavailable && e.RetryAfter == 0
+			},
+		},
+		{
+			name:      "server error",
+			handler:   status(http.StatusBadGateway, ""),
+			calls:     3,
+			retryable: true,
+			check: func(err error) bool {
+				var e *StatusError
+				return errors.As(err, &e) && e.StatusCode == http.StatusBadGateway
+			},
+		},
+		{
+			name:    "client error",
+			handler: status(http.StatusNotFound, ""),
+			calls:   1,
+			check: func(err error) bool {
+				var e *StatusError
+				return errors.As(err, &e) && e.StatusCode == http.StatusNotFound
+			},
+		},
+		{
+			name:      "client timeout",
+			handler:   slow(200 * time.Millisecond),
+			calls:     3,
+			retryable: true,
+			check: func(err error) bool {
+				var ne net.Error
+				return errors.As(err, &ne) && ne.Timeout()
+			},
+		},
+		{
+			name:    "invalid JSON",
+			handler: body(`<html>mantenimiento</html>`),
+			calls:   1,
+			check: func(err error) bool {
+				var e *DecodeError
+				return errors.As(err, &e) && e.Unwrap() != nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, calls := scripted(t, tt.handler)
+			client := srv.Client()
+			client.Timeout = 50 * time.Millisecond
+
+			var v any
+			err := getJSON(context.Background(), client, fastRetry, srv.URL, &v)
+			if !tt.check(err) {
+				t.Fatalf("unexpected error %T: %v", err, err)
+			}
+			if calls.Load() != tt.calls {
+				t.Errorf("%d calls, want %d", calls.Load(), tt.calls)
+			}
+			if Retryable(err) != tt.retryable {
+				t.Errorf("Retryable = %v, want %v", !tt.retryable, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestGetJSONCanceledWhileWaiting(t *testing.T) {
+	srv, calls := scripted(t, status(http.StatusServiceUnavailable, ""))
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Minute, MaxDelay: time.Minute}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	var v any
+	start := time.Now()
+	err := getJSON(ctx, srv.Client(), policy, srv.URL, &v)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("returned after %s, the wait was not interrupted", elapsed)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1", calls.Load())
+	}
+	if Retryable(err) {
+		t.Error("a canceled request must not be retryable")
+	}
+}
+
+func TestGetJSONCallerDeadlineStopsRetries(t *testing.T) {
+	srv, calls := scripted(t, slow(time.Second))
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var v any
+	if err := getJSON(ctx, srv.Client(), policy, srv.URL, &v); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want 1: the caller's deadline ends the retries", calls.Load())
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 1; attempt <= 70; attempt++ {
+		want := policy.MaxDelay // 100ms, 200ms, 400ms, 800ms y después el tope, aunque el shift desborde
+		if attempt <= 4 {
+			want = policy.BaseDelay << (attempt - 1)
+		}
+		for range 20 {
+			d := backoff(policy, attempt)
+			if d < want/2 || d > want {
+				t.Fatalf("attempt %d: backoff %s outside [%s, %s]", attempt, d, want/2, want)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"-5", 0},
+		{"120", 2 * time.Minute},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0},
+		{"pronto", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
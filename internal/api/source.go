@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Quote is a normalized price reading returned by any QuoteSource.
+type Quote struct {
+	Moneda   string // instrument, e.g. "USDT"
+	Exchange string // venue, e.g. "binancep2p"
+	Ask      float64
+	TotalAsk float64
+	Bid      float64
+	TotalBid float64
+	Time     int64 // unix timestamp reported by the source (0 if unknown)
+}
+
+// SourceTime returns the timestamp reported by the source, or the zero time if unknown.
+func (q Quote) SourceTime() time.Time {
+	if q.Time <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(q.Time, 0)
+}
+
+// QuoteSource is implemented by every price provider the pipeline can query.
+type QuoteSource interface {
+	// Name identifies the venue; it is stored in the exchange column.
+	Name() string
+	// Instrument is the moneda the source quotes, e.g. "USDT".
+	Instrument() string
+	// Fetch queries the provider and returns one or more quotes.
+	Fetch(ctx context.Context) ([]Quote, error)
+}
+
+// Source kinds accepted by NewSource.
+const (
+	SourceCriptoYa    = "criptoya"     // single exchange on criptoya.com
+	SourceCriptoYaAll = "criptoya_all" // every exchange on criptoya.com
+	SourceBinanceP2P  = "binancep2p"   // Binance P2P advert search
+)
+
+// NewSource builds the QuoteSource of the given kind for coin/fiat. exchange is
+// only used by SourceCriptoYa; url, if not empty, overrides the default endpoint.
+func NewSource(kind, coin, fiat, exchange, url string) (QuoteSource, error) {
+	switch kind {
+	case SourceCriptoYa:
+		if exchange == "" {
+			return nil, fmt.Errorf("source %q requires an exchange", kind)
+		}
+		s := NewCriptoYa(exchange, coin, fiat)
+		if url != "" {
+			s.URL = url
+		}
+		return s, nil
+	case SourceCriptoYaAll:
+		s := NewCriptoYaAll(coin, fiat)
+		if url != "" {
+			s.URL = url
+		}
+		return s, nil
+	case SourceBinanceP2P:
+		s := NewBinanceP2P(coin, fiat)
+		if url != "" {
+			s.URL = url
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown source %q", kind)
+	}
+}
+
+// Best returns the quote with the highest bid and the one with the lowest
+// total ask among quotes. ok is false when no quote has a usable price.
+func Best(quotes []Quote) (bestBid, bestAsk Quote, ok bool) {
+	for _, q := range quotes {
+		if q.Bid > 0 && q.Bid > bestBid.Bid {
+			bestBid = q
+			ok = true
+		}
+		if q.TotalAsk > 0 && (bestAsk.TotalAsk == 0 || q.TotalAsk < bestAsk.TotalAsk) {
+			bestAsk = q
+			ok = true
+		}
+	}
+	return bestBid, bestAsk, ok
+}
@@ -0,0 +1,365 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cotizaciones/internal/db"
+)
+
+const (
+	prefix = "cotizaciones-"
+	suffix = ".ndjson.gz"
+	// sumExt is the checksum sidecar, in sha256sum format so `sha256sum -c` works.
+	sumExt = ".sha256"
+	// newExt marks a file while it is being written.
+	newExt = ".new"
+	// stampFmt names the file of each append inside its month.
+	stampFmt = "20060102T150405.000000000Z"
+)
+
+// Archive keeps pruned cotizaciones under Dir, one gzip file per prune and UTC
+// month (cotizaciones-YYYY-MM-<stamp>.ndjson.gz, plus its .sha256), one JSON row
+// per line with datetimes in UTC as stored in the DB. Files are never rewritten:
+// an append costs only its own rows. Months are UTC months, unlike the La Paz
+// months shown to users: the rows of the last evening (from 20:00) of a La Paz
+// month land in the next month's files. Older single-file months
+// (cotizaciones-YYYY-MM.ndjson.gz) are still read.
+type Archive struct {
+	Dir string
+}
+
+// New returns an Archive writing into dir.
+func New(dir string) *Archive {
+	return &Archive{Dir: dir}
+}
+
+// Path returns the archive file of month ("2006-01") written at at.
+func (a *Archive) Path(month string, at time.Time) string {
+	return filepath.Join(a.Dir, prefix+month+"-"+at.UTC().Format(stampFmt)+suffix)
+}
+
+// Append writes rows into new files, one per UTC month of their datetime. It
+// implements db.ArchiveFunc. If the prune that called it is rolled back the rows
+// stay in the DB and are archived again later, so the files of a month may
+// repeat rows; they are harmless on re-import (see db.ImportCotizaciones).
+func (a *Archive) Append(ctx context.Context, rows []db.Cotizacion) error {
+	if err := os.MkdirAll(a.Dir, 0755); err != nil {
+		return fmt.Errorf("error creating archive directory: %w", err)
+	}
+	if err := a.recover(); err != nil {
+		return err
+	}
+
+	byMonth := make(map[string][]db.Cotizacion)
+	for _, c := range rows {
+		if len(c.Datetime) < 7 {
+			return fmt.Errorf("datetime inválido %q (%s/%s)", c.Datetime, c.Moneda, c.Exchange)
+		}
+		byMonth[c.Datetime[:7]] = append(byMonth[c.Datetime[:7]], c)
+	}
+	months := make([]string, 0, len(byMonth))
+	for m := range byMonth {
+		months = append(months, m)
+	}
+	sort.Strings(months)
+
+	now := time.Now()
+	for _, m := range months {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := writeFile(a.Path(m, now), byMonth[m]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile writes rows to the new file path. The data goes to path.new, then
+// its checksum is written and the data renamed into place, so a crash leaves
+// either nothing or a pair recoverFile can finish.
+func writeFile(path string, rows []db.Cotizacion) error {
+	tmp := path + newExt
+	out, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", tmp, err)
+	}
+	defer os.Remove(tmp) // no-op once renamed
+	defer out.Close()
+
+	h := sha256.New()
+	zw := gzip.NewWriter(io.MultiWriter(out, h))
+	enc := json.NewEncoder(zw)
+	for _, c := range rows {
+		if err := enc.Encode(c); err != nil {
+			return fmt.Errorf("error writing %s: %w", tmp, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmp, err)
+	}
+	if err := out.Sync(); err != nil {
+		return fmt.Errorf("error syncing %s: %w", tmp, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("error writing %s: %w", tmp, err)
+	}
+
+	if err := writeSum(path+sumExt, filepath.Base(path), h.Sum(nil)); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("error renaming %s: %w", tmp, err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// recover runs recoverFile on every file left half-written in Dir.
+func (a *Archive) recover() error {
+	leftovers, err := filepath.Glob(filepath.Join(a.Dir, prefix+"*"+suffix+newExt))
+	if err != nil {
+		return fmt.Errorf("error reading archive directory: %w", err)
+	}
+	for _, tmp := range leftovers {
+		if err := recoverFile(strings.TrimSuffix(tmp, newExt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recoverFile completes or discards a write of path interrupted by a crash: a
+// path.new that matches its checksum is renamed into place, anything else left
+// over is removed.
+func recoverFile(path string) error {
+	tmp := path + newExt
+	if _, err := os.Stat(path); err == nil {
+		// ya renombrado: solo queda basura
+		os.Remove(tmp)
+		return nil
+	}
+	want, err := readSum(path + sumExt)
+	if err == nil {
+		if got, err := fileSum(tmp); err == nil && bytes.Equal(got, want) {
+			if err := os.Rename(tmp, path); err != nil {
+				return fmt.Errorf("error recovering %s: %w", path, err)
+			}
+			return syncDir(filepath.Dir(path))
+		}
+	}
+	os.Remove(tmp)
+	os.Remove(path + sumExt)
+	return nil
+}
+
+// Files returns the archive files in dir, oldest month first and, inside a
+// month, in the order they were written.
+func (a *Archive) Files() ([]string, error) {
+	entries, err := os.ReadDir(a.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading archive directory: %w", err)
+	}
+	var out []string
+	for _, e := range entries {
+		if name := e.Name(); !e.IsDir() && strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) {
+			out = append(out, filepath.Join(a.Dir, name))
+		}
+	}
+	// sin la extensión, el archivo mensual antiguo va antes que los de cada append
+	sort.Slice(out, func(i, j int) bool {
+		return strings.TrimSuffix(out[i], suffix) < strings.TrimSuffix(out[j], suffix)
+	})
+	return out, nil
+}
+
+// Verify checks path against its checksum sidecar.
+func Verify(path string) error {
+	got, err := fileSum(path)
+	if err != nil {
+		return err
+	}
+	return checkSum(path, got)
+}
+
+// Reader streams the rows of an archive file. The checksum is verified as the
+// file is read: Next reports a mismatch instead of io.EOF.
+type Reader struct {
+	path string
+	f    *os.File
+	h    hash.Hash
+	zr   *gzip.Reader
+	sc   *bufio.Scanner
+	line int
+}
+
+// Open opens an archive file for reading.
+func Open(path string) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	h := sha256.New()
+	zr, err := gzip.NewReader(io.TeeReader(f, h))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error reading gzip %s: %w", path, err)
+	}
+	sc := bufio.NewScanner(zr)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &Reader{path: path, f: f, h: h, zr: zr, sc: sc}, nil
+}
+
+// Next returns the next row, or io.EOF after the last one.
+func (r *Reader) Next() (db.Cotizacion, error) {
+	for r.sc.Scan() {
+		r.line++
+		if len(bytes.TrimSpace(r.sc.Bytes())) == 0 {
+			continue
+		}
+		var c db.Cotizacion
+		if err := json.Unmarshal(r.sc.Bytes(), &c); err != nil {
+			return db.Cotizacion{}, fmt.Errorf("%s línea %d: %w", r.path, r.line, err)
+		}
+		return c, nil
+	}
+	if err := r.sc.Err(); err != nil {
+		return db.Cotizacion{}, fmt.Errorf("error reading %s: %w", r.path, err)
+	}
+	if err := checkSum(r.path, r.h.Sum(nil)); err != nil {
+		return db.Cotizacion{}, err
+	}
+	return db.Cotizacion{}, io.EOF
+}
+
+// Close closes the underlying file.
+func (r *Reader) Close() error {
+	r.zr.Close()
+	return r.f.Close()
+}
+
+// Walk streams every row of every archive file, in Files order, calling fn
+// for each one. It stops at the first error, including a checksum mismatch.
+func (a *Archive) Walk(ctx context.Context, fn func(db.Cotizacion) error) error {
+	files, err := a.Files()
+	if err != nil {
+		return err
+	}
+	for _, path := range files {
+		if err := ReadFile(ctx, path, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadFile streams the rows of one archive file into fn.
+func ReadFile(ctx context.Context, path string, fn func(db.Cotizacion) error) error {
+	r, err := Open(path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		c, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+}
+
+// checkSum compares got with the sidecar of path. A file without sidecar is
+// reported as an error as well.
+func checkSum(path string, got []byte) error {
+	want, err := readSum(path + sumExt)
+	if err != nil {
+		return fmt.Errorf("error reading checksum of %s: %w", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		return fmt.Errorf("%s no coincide con su checksum (%s)", path, path+sumExt)
+	}
+	return nil
+}
+
+// fileSum returns the sha256 of the file at path.
+func fileSum(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, fmt.Errorf("error reading %s: %w", path, err)
+	}
+	return h.Sum(nil), nil
+}
+
+// readSum parses a "<hex>  <name>" sidecar.
+func readSum(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("checksum vacío en %s", path)
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("checksum inválido en %s: %w", path, err)
+	}
+	return sum, nil
+}
+
+// writeSum writes and syncs a sha256sum-style sidecar for name.
+func writeSum(path, name string, sum []byte) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", path, err)
+	}
+	if _, err := fmt.Fprintf(f, "%s  %s\n", hex.EncodeToString(sum), name); err != nil {
+		f.Close()
+		return fmt.Errorf("error writing %s: %w", path, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("error syncing %s: %w", path, err)
+	}
+	return f.Close()
+}
+
+// syncDir makes the renames in dir durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", dir, err)
+	}
+	defer d.Close()
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("error syncing %s: %w", dir, err)
+	}
+	return nil
+}
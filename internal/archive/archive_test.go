@@ -0,0 +1,187 @@
+package archive
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cotizaciones/internal/db"
+)
+
+func row(moneda, datetime string, v float64) db.Cotizacion {
+	return db.Cotizacion{Moneda: moneda, Exchange: "binancep2p", Datetime: datetime, Cotizacion: v}
+}
+
+// walkAll returns every archived row, in Walk order.
+func walkAll(t *testing.T, a *Archive) []db.Cotizacion {
+	t.Helper()
+	var got []db.Cotizacion
+	err := a.Walk(context.Background(), func(c db.Cotizacion) error {
+		got = append(got, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got
+}
+
+func TestAppend(t *testing.T) {
+	ctx := context.Background()
+	a := New(t.TempDir())
+
+	first := []db.Cotizacion{row("usdt", "2025-03-31 23:50:00", 6.95), row("usdt", "2025-02-10 12:00:00", 6.90)}
+	if err := a.Append(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	second := []db.Cotizacion{row("usdt", "2025-03-01 00:10:00", 6.97)}
+	if err := a.Append(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := a.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 {
+		t.Fatalf("got files %v, want one per append and month", files)
+	}
+	for _, f := range files {
+		if err := Verify(f); err != nil {
+			t.Error(err)
+		}
+	}
+
+	got := walkAll(t, a)
+	want := []db.Cotizacion{first[1], first[0], second[0]}
+	if len(got) != len(want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("row %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	if err := a.Append(ctx, []db.Cotizacion{row("usdt", "2025", 1)}); err == nil {
+		t.Error("want an error for a datetime without month")
+	}
+}
+
+func TestFilesLegacyMonthFirst(t *testing.T) {
+	a := New(t.TempDir())
+	stamped := a.Path("2025-03", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	legacy := filepath.Join(a.Dir, prefix+"2025-03"+suffix)
+	for _, p := range []string{stamped, legacy, a.Path("2025-02", time.Now())} {
+		if err := os.WriteFile(p, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := a.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 3 || files[1] != legacy || files[2] != stamped {
+		t.Errorf("got %v, want the old monthly file before the appends of its month", files)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	ctx := context.Background()
+	a := New(t.TempDir())
+	rows := []db.Cotizacion{row("usdt", "2025-03-10 12:00:00", 6.95)}
+
+	// crash entre el checksum y el rename: se completa
+	done := a.Path("2025-03", time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC))
+	if err := writeFile(done, rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(done, done+newExt); err != nil {
+		t.Fatal(err)
+	}
+
+	// crash antes del checksum: se descarta
+	partial := a.Path("2025-03", time.Date(2025, 4, 2, 0, 0, 0, 0, time.UTC))
+	if err := os.WriteFile(partial+newExt, []byte("truncado"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// checksum escrito a medias: se descartan ambos
+	torn := a.Path("2025-03", time.Date(2025, 4, 3, 0, 0, 0, 0, time.UTC))
+	if err := writeFile(torn, rows); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(torn, torn+newExt); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(torn+sumExt, []byte("ab"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Append(ctx, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(done); err != nil {
+		t.Errorf("interrupted write not completed: %v", err)
+	}
+	for _, p := range []string{done + newExt, partial + newExt, torn + newExt, torn + sumExt} {
+		if _, err := os.Stat(p); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s left over (%v)", filepath.Base(p), err)
+		}
+	}
+	if got := walkAll(t, a); len(got) != 1 || got[0] != rows[0] {
+		t.Errorf("got %+v, want %+v", got, rows)
+	}
+}
+
+func TestChecksumMismatch(t *testing.T) {
+	ctx := context.Background()
+	a := New(t.TempDir())
+	if err := a.Append(ctx, []db.Cotizacion{row("usdt", "2025-03-10 12:00:00", 6.95)}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := a.Files()
+	if err != nil || len(files) != 1 {
+		t.Fatalf("got %v, %v", files, err)
+	}
+	if err := writeSum(files[0]+sumExt, filepath.Base(files[0]), make([]byte, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Verify(files[0]); err == nil || !strings.Contains(err.Error(), "no coincide") {
+		t.Errorf("Verify: got %v, want a checksum mismatch", err)
+	}
+	err = a.Walk(ctx, func(db.Cotizacion) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "no coincide") {
+		t.Errorf("Walk: got %v, want a checksum mismatch", err)
+	}
+
+	os.Remove(files[0] + sumExt)
+	if err := Verify(files[0]); err == nil {
+		t.Error("Verify: want an error for a file without checksum")
+	}
+}
+
+func TestWalkStopsOnError(t *testing.T) {
+	ctx := context.Background()
+	a := New(t.TempDir())
+	rows := []db.Cotizacion{row("usdt", "2025-02-10 12:00:00", 6.90), row("usdt", "2025-03-10 12:00:00", 6.95)}
+	if err := a.Append(ctx, rows); err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err := a.Walk(ctx, func(db.Cotizacion) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("got %v after %d calls, want stop after 1", err, calls)
+	}
+}
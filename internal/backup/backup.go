@@ -0,0 +1,238 @@
+package backup
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cotizaciones/internal/db"
+)
+
+const (
+	prefix   = "cotizaciones-"
+	stampFmt = "20060102-150405"
+)
+
+// Options configures where snapshots are written and how many are kept.
+type Options struct {
+	Dir        string // directorio de snapshots
+	Gzip       bool   // comprimir cada snapshot (.db.gz)
+	KeepDaily  int    // últimos N días con snapshot (el más reciente de cada día)
+	KeepWeekly int    // últimas M semanas ISO con snapshot (el más reciente de cada semana)
+}
+
+// Snapshot is a backup file found in the snapshot directory.
+type Snapshot struct {
+	Path string
+	Time time.Time
+}
+
+// Create writes a timestamped snapshot of d into opts.Dir and rotates old ones.
+// It returns the snapshot path and the removed snapshots.
+func Create(ctx context.Context, d *db.DB, opts Options) (string, []string, error) {
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return "", nil, fmt.Errorf("error creating backup directory: %w", err)
+	}
+
+	path := filepath.Join(opts.Dir, prefix+time.Now().In(db.Location).Format(stampFmt)+".db")
+	if err := d.VacuumInto(ctx, path); err != nil {
+		return "", nil, err
+	}
+	if opts.Gzip {
+		gz, err := compress(path)
+		if err != nil {
+			os.Remove(path)
+			return "", nil, err
+		}
+		path = gz
+	}
+
+	removed, err := Rotate(opts.Dir, opts.KeepDaily, opts.KeepWeekly)
+	return path, removed, err
+}
+
+// List returns the snapshots in dir, newest first. File names carry La Paz
+// time, so Rotate keeps days and weeks of La Paz.
+func List(dir string) ([]Snapshot, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("error reading backup directory: %w", err)
+	}
+	var out []Snapshot
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz"), ".db")
+		t, err := time.ParseInLocation(stampFmt, stamp, db.Location)
+		if err != nil {
+			continue // no es un snapshot nuestro
+		}
+		out = append(out, Snapshot{Path: filepath.Join(dir, name), Time: t})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time.After(out[j].Time) })
+	return out, nil
+}
+
+// Rotate keeps the newest snapshot of each of the last keepDaily days and of each
+// of the last keepWeekly ISO weeks, and deletes the rest. With both at zero
+// nothing is deleted.
+func Rotate(dir string, keepDaily, keepWeekly int) ([]string, error) {
+	if keepDaily <= 0 && keepWeekly <= 0 {
+		return nil, nil
+	}
+	snaps, err := List(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+	var removed []string
+	for _, s := range snaps {
+		keep := false
+		if day := s.Time.Format("2006-01-02"); !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep = true
+		}
+		y, w := s.Time.ISOWeek()
+		if week := fmt.Sprintf("%d-W%02d", y, w); !weeks[week] && len(weeks) < keepWeekly {
+			weeks[week] = true
+			keep = true
+		}
+		if keep {
+			continue
+		}
+		if err := os.Remove(s.Path); err != nil {
+			return removed, fmt.Errorf("error removing snapshot %s: %w", s.Path, err)
+		}
+		removed = append(removed, s.Path)
+	}
+	return removed, nil
+}
+
+// Restore replaces the database at dbPath with the snapshot src (plain or .gz).
+// The snapshot is copied next to dbPath and validated with PRAGMA integrity_check
+// before the swap. The previous database is checkpointed and kept, with any
+// -wal/-shm left, as dbPath+".pre-restore" (or, if that exists, with a timestamp
+// appended); its path is returned. Nothing else may have the database open while
+// restoring.
+func Restore(ctx context.Context, src, dbPath string) (string, error) {
+	tmp := dbPath + ".restore"
+	if err := copySnapshot(src, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+	if err := db.IntegrityCheck(ctx, tmp); err != nil {
+		os.Remove(tmp)
+		return "", err
+	}
+
+	var kept string
+	if _, err := os.Stat(dbPath); err == nil {
+		// lo confirmado en el WAL pasa a la base antes de apartarla
+		if err := db.Checkpoint(ctx, dbPath); err != nil {
+			os.Remove(tmp)
+			return "", err
+		}
+		kept = preRestorePath(dbPath)
+		// se apartan también -wal/-shm: un WAL viejo junto a dbPath se aplicaría sobre la restaurada
+		for _, suffix := range []string{"", "-wal", "-shm"} {
+			if err := os.Rename(dbPath+suffix, kept+suffix); err != nil && !os.IsNotExist(err) {
+				os.Remove(tmp)
+				return "", fmt.Errorf("error keeping previous database: %w", err)
+			}
+		}
+	}
+	if err := os.Rename(tmp, dbPath); err != nil {
+		return kept, fmt.Errorf("error swapping restored database: %w", err)
+	}
+	return kept, nil
+}
+
+// preRestorePath returns where the database replaced by Restore is kept, without
+// overwriting an earlier one.
+func preRestorePath(dbPath string) string {
+	kept := dbPath + ".pre-restore"
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if _, err := os.Stat(kept + suffix); err == nil {
+			return kept + "-" + time.Now().In(db.Location).Format(stampFmt)
+		}
+	}
+	return kept
+}
+
+// compress gzips path into path+".gz" and removes the original.
+func compress(path string) (string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening snapshot: %w", err)
+	}
+	defer in.Close()
+
+	gzPath := path + ".gz"
+	out, err := os.Create(gzPath)
+	if err != nil {
+		return "", fmt.Errorf("error creating %s: %w", gzPath, err)
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(gzPath)
+		return "", fmt.Errorf("error compressing snapshot: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(gzPath)
+		return "", fmt.Errorf("error compressing snapshot: %w", err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(gzPath)
+		return "", fmt.Errorf("error writing %s: %w", gzPath, err)
+	}
+	in.Close()
+	if err := os.Remove(path); err != nil {
+		return gzPath, fmt.Errorf("error removing uncompressed snapshot: %w", err)
+	}
+	return gzPath, nil
+}
+
+// copySnapshot copies src to dst, decompressing it if it ends in .gz.
+func copySnapshot(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("error opening snapshot: %w", err)
+	}
+	defer in.Close()
+
+	var r io.Reader = in
+	if strings.HasSuffix(src, ".gz") {
+		zr, err := gzip.NewReader(in)
+		if err != nil {
+			return fmt.Errorf("error reading gzip snapshot: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %w", dst, err)
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return fmt.Errorf("error copying snapshot: %w", err)
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return fmt.Errorf("error syncing %s: %w", dst, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,170 @@
+package backup
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cotizaciones/internal/db"
+)
+
+// newDB opens a file database in a temp dir with one cotizacion.
+func newDB(t *testing.T, moneda string) (*db.DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "cotizaciones.db")
+	d, err := db.New(db.Options{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { d.Close() })
+	if _, err := d.InsertCotizacion(context.Background(), db.Cotizacion{Moneda: moneda, Exchange: "binancep2p", Cotizacion: 6.95, Purchase: 6.97}); err != nil {
+		t.Fatal(err)
+	}
+	return d, path
+}
+
+// touch creates empty snapshot files stamped at the given La Paz times.
+func touch(t *testing.T, dir string, stamps ...string) {
+	t.Helper()
+	for _, s := range stamps {
+		if err := os.WriteFile(filepath.Join(dir, prefix+s+".db"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir, "20250314-230000", "20250315-010000")
+	for _, name := range []string{"notas.txt", prefix + "roto.db", prefix + "20250316-000000.db.gz"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	snaps, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(snaps) != 3 {
+		t.Fatalf("got %+v, want the 3 snapshots", snaps)
+	}
+	want := time.Date(2025, 3, 16, 0, 0, 0, 0, db.Location)
+	if !snaps[0].Time.Equal(want) || snaps[0].Time.Location() != db.Location {
+		t.Errorf("newest: got %s, want %s in La Paz", snaps[0].Time, want)
+	}
+	if !strings.HasSuffix(snaps[2].Path, "20250314-230000.db") {
+		t.Errorf("oldest: got %s", snaps[2].Path)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir := t.TempDir()
+	touch(t, dir,
+		"20250317-100000", "20250317-080000", // lunes: se conserva el más reciente
+		"20250316-230000", // domingo (semana anterior)
+		"20250315-120000",
+		"20250310-120000", // semana 11
+		"20250303-120000", // semana 10
+		"20250224-120000", // semana 9
+	)
+
+	removed, err := Rotate(dir, 2, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, r := range removed {
+		names = append(names, strings.TrimSuffix(strings.TrimPrefix(filepath.Base(r), prefix), ".db"))
+	}
+	// días: 17 y 16; semanas: 12 (17), 11 (16) y 10 (03)
+	want := []string{"20250317-080000", "20250315-120000", "20250310-120000", "20250224-120000"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("removed %v, want %v", names, want)
+	}
+
+	if removed, err := Rotate(dir, 0, 0); err != nil || removed != nil {
+		t.Errorf("keep nothing configured: got %v, %v, want no removal", removed, err)
+	}
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	ctx := context.Background()
+	src, _ := newDB(t, "USDT")
+	dir := t.TempDir()
+
+	snap, removed, err := Create(ctx, src, Options{Dir: dir, Gzip: true, KeepDaily: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(snap, ".db.gz") || len(removed) != 0 {
+		t.Fatalf("got %s (removed %v), want a gzip snapshot", snap, removed)
+	}
+	if _, err := os.Stat(strings.TrimSuffix(snap, ".gz")); !os.IsNotExist(err) {
+		t.Errorf("uncompressed snapshot left over (%v)", err)
+	}
+	if snaps, err := List(dir); err != nil || len(snaps) != 1 || snaps[0].Path != snap {
+		t.Errorf("List: got %+v, %v", snaps, err)
+	}
+
+	// la base reemplazada queda aparte, sin pisar una anterior
+	target, targetPath := newDB(t, "BTC")
+	target.Close()
+	kept, err := Restore(ctx, snap, targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept != targetPath+".pre-restore" {
+		t.Errorf("kept %s, want %s.pre-restore", kept, targetPath)
+	}
+	kept2, err := Restore(ctx, snap, targetPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept2 == kept || !strings.HasPrefix(kept2, kept+"-") {
+		t.Errorf("second restore kept %s, want a timestamped %s-*", kept2, kept)
+	}
+
+	restored, err := db.New(db.Options{Path: targetPath, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+	if _, err := restored.GetLatestByMoneda(ctx, "USDT"); err != nil {
+		t.Errorf("restored database without the snapshot rows: %v", err)
+	}
+	if err := db.IntegrityCheck(ctx, kept); err != nil {
+		t.Errorf("previous database not kept intact: %v", err)
+	}
+}
+
+func TestRestoreRejectsCorruptSnapshot(t *testing.T) {
+	ctx := context.Background()
+	d, path := newDB(t, "USDT")
+	d.Close()
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := filepath.Join(t.TempDir(), prefix+"20250314-230000.db")
+	if err := os.WriteFile(bad, []byte(strings.Repeat("no es sqlite ", 400)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Restore(ctx, bad, path); err == nil {
+		t.Fatal("want an error for a corrupt snapshot")
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil || string(after) != string(before) {
+		t.Errorf("database changed by a failed restore (%v)", err)
+	}
+	for _, p := range []string{path + ".restore", path + ".pre-restore"} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s left over (%v)", filepath.Base(p), err)
+		}
+	}
+}
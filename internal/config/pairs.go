@@ -0,0 +1,141 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"cotizaciones/internal/api"
+	"cotizaciones/internal/instrument"
+)
+
+// defaultPairsPath is read when PAIRS_CONFIG is not set; if missing, DefaultPairs is used.
+const defaultPairsPath = "pairs.json"
+
+// Pair describes a trading pair fetched, stored and exported on every run.
+// Precision and DisplayName also define how its moneda is shown (see Instrument).
+type Pair struct {
+	Moneda      string `json:"moneda"`             // stored moneda, e.g. "USDT"
+	Fiat        string `json:"fiat"`               // quote currency, e.g. "BOB"
+	Source      string `json:"source"`             // criptoya | criptoya_all | binancep2p
+	Exchange    string `json:"exchange,omitempty"` // criptoya: exchange queried; criptoya_all: exchange summarized (empty: latest of any)
+	URL         string `json:"url,omitempty"`      // overrides the source endpoint
+	Precision   int    `json:"precision"`          // decimals used when displaying prices
+	DisplayName string `json:"display_name"`
+}
+
+// DefaultPairs is the built-in configuration.
+var DefaultPairs = []Pair{
+	{Moneda: "USDT", Fiat: "BOB", Source: api.SourceCriptoYaAll, Precision: 4, DisplayName: "USDT/BOB"},
+	{Moneda: "USDT", Fiat: "BOB", Source: api.SourceBinanceP2P, Precision: 4, DisplayName: "USDT/BOB (Binance P2P)"},
+	{Moneda: "USDC", Fiat: "BOB", Source: api.SourceCriptoYaAll, Precision: 4, DisplayName: "USDC/BOB"},
+	{Moneda: "BTC", Fiat: "BOB", Source: api.SourceCriptoYaAll, Precision: 2, DisplayName: "BTC/BOB"},
+}
+
+// LoadPairs reads the pairs from the JSON file in PAIRS_CONFIG (or pairs.json).
+// If PAIRS_CONFIG is not set and pairs.json does not exist, DefaultPairs is returned.
+// A missing precision takes the one of the built-in instrument of the moneda and
+// is required for any other moneda. It must run before instrument.Register.
+func LoadPairs() ([]Pair, error) {
+	path := os.Getenv("PAIRS_CONFIG")
+	explicit := path != ""
+	if !explicit {
+		path = defaultPairsPath
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return DefaultPairs, nil
+		}
+		return nil, fmt.Errorf("error reading pairs config: %w", err)
+	}
+
+	// precision se lee aparte: un valor ausente no puede confundirse con 0 decimales
+	var raw []struct {
+		Precision *int `json:"precision"`
+	}
+	var pairs []Pair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return nil, fmt.Errorf("error parsing pairs config %s: %w", path, err)
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing pairs config %s: %w", path, err)
+	}
+	precision := make(map[string]int)
+	for i, p := range pairs {
+		if p.Moneda == "" || p.Fiat == "" || p.Source == "" {
+			return nil, fmt.Errorf("pairs config %s: entry %d requires moneda, fiat and source", path, i)
+		}
+		if p.DisplayName == "" {
+			pairs[i].DisplayName = p.Moneda + "/" + p.Fiat
+		}
+		switch builtin, ok := instrument.Get(p.Moneda); {
+		case raw[i].Precision != nil:
+			if *raw[i].Precision < 0 {
+				return nil, fmt.Errorf("pairs config %s: entry %d has negative precision %d", path, i, *raw[i].Precision)
+			}
+		case ok:
+			pairs[i].Precision = builtin.Precision
+		default:
+			return nil, fmt.Errorf("pairs config %s: entry %d requires precision for %s", path, i, p.Moneda)
+		}
+		// una sola precisión por moneda: es la que muestra el registro de instrumentos
+		if prev, ok := precision[p.Moneda]; ok && prev != pairs[i].Precision {
+			return nil, fmt.Errorf("pairs config %s: entry %d sets precision %d for %s, an earlier entry sets %d", path, i, pairs[i].Precision, p.Moneda, prev)
+		}
+		precision[p.Moneda] = pairs[i].Precision
+	}
+	return pairs, nil
+}
+
+// Instrument returns the registry entry of the pair's moneda, named after its
+// DisplayName and shown with its Precision.
+func (p Pair) Instrument() instrument.Instrument {
+	inst := instrument.Instrument{
+		Key:       p.Moneda,
+		Exchange:  p.Exchange,
+		Name:      p.DisplayName,
+		Emoji:     "🪙",
+		Precision: p.Precision,
+		Source:    "CriptoYa",
+	}
+	if p.Source == api.SourceBinanceP2P {
+		inst.Exchange = api.NewBinanceP2P(p.Moneda, p.Fiat).Name()
+		inst.Source = "Binance P2P"
+	}
+	inst.Title = strings.ToUpper(p.DisplayName + " – " + inst.Source)
+	return inst
+}
+
+// Instruments returns one registry entry per moneda of pairs, built from the
+// first pair of each moneda. For a built-in moneda the generated Moneda/Fiat
+// name is left empty: only an explicit display_name is a rename (that
+// instrument.Register reports).
+func Instruments(pairs []Pair) []instrument.Instrument {
+	var out []instrument.Instrument
+	seen := make(map[string]bool)
+	for _, p := range pairs {
+		if !seen[p.Moneda] {
+			seen[p.Moneda] = true
+			inst := p.Instrument()
+			if _, ok := instrument.Get(p.Moneda); ok && p.DisplayName == p.Moneda+"/"+p.Fiat {
+				inst.Name = ""
+			}
+			out = append(out, inst)
+		}
+	}
+	return out
+}
+
+// NewSource builds the QuoteSource configured for the pair.
+func (p Pair) NewSource() (api.QuoteSource, error) {
+	return api.NewSource(p.Source, p.Moneda, p.Fiat, p.Exchange, p.URL)
+}
+
+// Format formats a price with the pair's precision.
+func (p Pair) Format(v float64) string {
+	return fmt.Sprintf("%.*f", p.Precision, v)
+}
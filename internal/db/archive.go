@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ArchiveFunc receives the raw rows a prune is about to delete, inside the
+// prune's transaction; an error aborts the prune and nothing is deleted.
+type ArchiveFunc func(ctx context.Context, rows []Cotizacion) error
+
+// ErrArchive wraps the errors of the archiver, so callers can tell a failed
+// archive (nothing deleted, retry on the next run) from a failed prune.
+var ErrArchive = errors.New("error archiving cotizaciones")
+
+// SetArchiver makes every prune (PruneByPolicy, RollupAndPrune, DeleteOlderThan)
+// hand the rows it deletes to fn first. nil disables archiving.
+func (d *DB) SetArchiver(fn ArchiveFunc) {
+	d.archive = fn
+}
+
+// deleteCotizaciones archives (if an archiver is set) and deletes the raw rows
+// matching where. Callers run it inside a transaction.
+func (d *DB) deleteCotizaciones(ctx context.Context, where string, args ...any) (int64, error) {
+	if d.archive != nil {
+		rows, err := d.queryCotizaciones(ctx, "SELECT "+cotizacionCols+" FROM cotizaciones WHERE "+where+" ORDER BY datetime ASC", args...)
+		if err != nil {
+			return 0, err
+		}
+		if len(rows) > 0 {
+			if err := d.archive(ctx, rows); err != nil {
+				return 0, fmt.Errorf("%w: %w", ErrArchive, err)
+			}
+		}
+	}
+
+	result, err := d.q.ExecContext(ctx, "DELETE FROM cotizaciones WHERE "+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting old cotizaciones: %w", err)
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,71 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// VacuumInto writes a consistent, compacted copy of the database to path using
+// VACUUM INTO. It is safe while other connections read or write; path must not exist.
+func (d *DB) VacuumInto(ctx context.Context, path string) error {
+	if _, err := d.conn.ExecContext(ctx, "VACUUM INTO ?", path); err != nil {
+		return fmt.Errorf("error writing snapshot %s: %w", path, err)
+	}
+	return nil
+}
+
+// Checkpoint opens the database file at path and runs PRAGMA wal_checkpoint(TRUNCATE),
+// so every committed transaction in its WAL is written into the main file. It fails
+// if another connection keeps the checkpoint from completing.
+func Checkpoint(ctx context.Context, path string) error {
+	conn, err := sql.Open("sqlite", Options{Path: path, BusyTimeout: DefaultOptions().BusyTimeout}.DSN())
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	var busy, logFrames, checkpointed int
+	if err := conn.QueryRowContext(ctx, "PRAGMA wal_checkpoint(TRUNCATE)").Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return fmt.Errorf("error checkpointing %s: %w", path, err)
+	}
+	if busy != 0 {
+		return fmt.Errorf("checkpoint de %s incompleto: la base está en uso", path)
+	}
+	return nil
+}
+
+// IntegrityCheck opens the database file at path read-only and runs
+// PRAGMA integrity_check, returning an error listing the problems found.
+func IntegrityCheck(ctx context.Context, path string) error {
+	conn, err := sql.Open("sqlite", Options{Path: path, ReadOnly: true}.DSN())
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", path, err)
+	}
+	defer conn.Close()
+
+	rows, err := conn.QueryContext(ctx, "PRAGMA integrity_check")
+	if err != nil {
+		return fmt.Errorf("error checking %s: %w", path, err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			return fmt.Errorf("error reading integrity_check: %w", err)
+		}
+		if msg != "ok" {
+			problems = append(problems, msg)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error checking %s: %w", path, err)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("integrity_check de %s falló: %s", path, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Interval is the width of a candle bucket
+type Interval string
+
+const (
+	Interval5m Interval = "5m"
+	Interval1h Interval = "1h"
+	Interval1d Interval = "1d"
+	Interval1w Interval = "1w"
+)
+
+// bucketExpr returns the SQL expression that maps datetime to the start of its bucket.
+func (i Interval) bucketExpr() (string, error) {
+	switch i {
+	case Interval5m:
+		return "strftime('%Y-%m-%d %H:', datetime) || printf('%02d', CAST(strftime('%M', datetime) AS INTEGER) / 5 * 5) || ':00'", nil
+	case Interval1h:
+		return hourBucketExpr, nil
+	case Interval1d:
+		return dayBucketExpr, nil
+	case Interval1w:
+		// Semanas de La Paz que empiezan el lunes
+		return "date(datetime, '" + localModifier + "', '-' || ((CAST(strftime('%w', datetime, '" + localModifier + "') AS INTEGER) + 6) % 7) || ' days')", nil
+	default:
+		return "", fmt.Errorf("unsupported interval %q", i)
+	}
+}
+
+// rollupTable returns the OHLC table holding pruned history for the interval, if any.
+func (i Interval) rollupTable() string {
+	switch i {
+	case Interval1h:
+		return "cotizaciones_hourly"
+	case Interval1d:
+		return "cotizaciones_daily"
+	}
+	return ""
+}
+
+// GetCandles returns OHLC buckets of cotizacion for moneda in [from, to), oldest first.
+// If exchange is empty every exchange is returned as its own series. For 1h and 1d
+// the rolled up history (see RollupAndPrune) is included, so candles extend past the
+// raw retention window; 5m and 1w are computed from raw rows only.
+func (d *DB) GetCandles(ctx context.Context, moneda, exchange string, interval Interval, from, to time.Time) ([]OHLC, error) {
+	expr, err := interval.bucketExpr()
+	if err != nil {
+		return nil, err
+	}
+
+	where := "moneda = ? AND datetime >= ? AND datetime < ?"
+	args := []any{moneda, FormatTime(from), FormatTime(to)}
+	if exchange != "" {
+		where += " AND COALESCE(exchange, '') = ?"
+		args = append(args, exchange)
+	}
+	query := ohlcQuery(expr, where)
+
+	if table := interval.rollupTable(); table != "" {
+		// Los buckets agregados no se solapan con filas crudas: RollupAndPrune borra
+		// todas las filas de cada bucket que agrega.
+		// Los buckets diarios son días de La Paz; los horarios, UTC.
+		rfrom, rto := FormatTime(from), FormatTime(to)
+		if interval == Interval1d {
+			rfrom, rto = from.In(Location).Format("2006-01-02"), to.In(Location).Format("2006-01-02")
+		}
+		rwhere := "moneda = ? AND bucket >= ? AND bucket < ?"
+		rargs := []any{moneda, rfrom, rto}
+		if exchange != "" {
+			rwhere += " AND exchange = ?"
+			rargs = append(rargs, exchange)
+		}
+		query += " UNION ALL SELECT moneda, exchange, bucket, open, high, low, close, avg, samples FROM " + table + " WHERE " + rwhere
+		args = append(args, rargs...)
+	}
+	query = "SELECT * FROM (" + query + ") ORDER BY bucket ASC, exchange ASC"
+
+	return d.queryOHLCRows(ctx, query, args...)
+}
+
+// GetRange returns the raw cotizaciones of moneda in [from, to), oldest first.
+func (d *DB) GetRange(ctx context.Context, moneda string, from, to time.Time) ([]Cotizacion, error) {
+	return d.queryCotizaciones(ctx,
+		"SELECT "+cotizacionCols+" FROM cotizaciones WHERE moneda = ? AND datetime >= ? AND datetime < ? ORDER BY datetime ASC",
+		moneda, FormatTime(from), FormatTime(to),
+	)
+}
+
+// GetValueAt returns the cotizacion of moneda on exchange in effect at t: the last
+// raw value at or before t or, once raw rows were pruned, the close of the last
+// hourly bucket that ended by t. Returns sql.ErrNoRows if there is no history.
+func (d *DB) GetValueAt(ctx context.Context, moneda, exchange string, t time.Time) (float64, error) {
+	var v float64
+	err := d.q.QueryRowContext(ctx,
+		`SELECT v FROM (
+			SELECT cotizacion AS v, datetime AS at FROM cotizaciones
+			 WHERE moneda = ?1 AND COALESCE(exchange, '') = ?2 AND datetime <= ?3 AND cotizacion IS NOT NULL
+			UNION ALL
+			SELECT close, bucket FROM cotizaciones_hourly
+			 WHERE moneda = ?1 AND exchange = ?2 AND bucket <= ?4
+		) ORDER BY at DESC LIMIT 1`,
+		moneda, exchange, FormatTime(t), FormatTime(t.Add(-time.Hour)),
+	).Scan(&v)
+	return v, err
+}
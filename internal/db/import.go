@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"fmt"
+)
+
+// ImportResult reports the progress of ImportCotizaciones.
+type ImportResult struct {
+	Total      int // rows received
+	Processed  int // rows in committed batches
+	Inserted   int // new rows
+	Duplicates int // rows already stored with the same (moneda, exchange, datetime)
+	RolledUp   int // rows skipped because their hour was already rolled up (see RollupAndPrune)
+	Batches    int // committed batches
+}
+
+// ImportCotizaciones stores historical rows keeping their datetime (already in
+// the storage format, UTC). Rows that collide with an existing (moneda, exchange,
+// datetime) are skipped, and so are rows whose hour is already in the hourly
+// rollup: the raw rows of that hour were pruned and cannot be told apart from the
+// imported ones, so merging them would count them twice. Each batch of batchSize rows is committed in its own
+// transaction and reported to progress, if not nil; on error the batches
+// already committed stay.
+func (d *DB) ImportCotizaciones(ctx context.Context, rows []Cotizacion, batchSize int, progress func(ImportResult)) (ImportResult, error) {
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+	res := ImportResult{Total: len(rows)}
+
+	for start := 0; start < len(rows); start += batchSize {
+		batch := rows[start:min(start+batchSize, len(rows))]
+		inserted, rolledUp, err := d.importBatch(ctx, batch)
+		if err != nil {
+			return res, fmt.Errorf("batch %d (rows %d-%d): %w", res.Batches+1, start+1, start+len(batch), err)
+		}
+		res.Batches++
+		res.Processed += len(batch)
+		res.Inserted += inserted
+		res.RolledUp += rolledUp
+		res.Duplicates += len(batch) - inserted - rolledUp
+		if progress != nil {
+			progress(res)
+		}
+	}
+	return res, nil
+}
+
+// importBatch inserts rows in one transaction and returns how many were new and
+// how many were skipped for falling in an already rolled up hour.
+func (d *DB) importBatch(ctx context.Context, rows []Cotizacion) (inserted, rolledUp int, err error) {
+	err = d.withTx(ctx, func(t *DB) error {
+		rolled, err := t.q.PrepareContext(ctx,
+			"SELECT EXISTS (SELECT 1 FROM cotizaciones_hourly WHERE moneda = ? AND exchange = ? AND bucket = strftime('%Y-%m-%d %H:00:00', ?))")
+		if err != nil {
+			return fmt.Errorf("error preparing rollup check: %w", err)
+		}
+		defer rolled.Close()
+		stmt, err := t.q.PrepareContext(ctx,
+			"INSERT INTO cotizaciones ("+cotizacionCols+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?) ON CONFLICT (moneda, exchange, datetime) DO NOTHING")
+		if err != nil {
+			return fmt.Errorf("error preparing insert: %w", err)
+		}
+		defer stmt.Close()
+
+		for _, c := range rows {
+			var isRolled bool
+			if err := rolled.QueryRowContext(ctx, c.Moneda, c.Exchange, c.Datetime).Scan(&isRolled); err != nil {
+				return fmt.Errorf("error checking rollup of %s/%s %s: %w", c.Moneda, c.Exchange, c.Datetime, err)
+			}
+			if isRolled {
+				rolledUp++
+				continue
+			}
+			result, err := stmt.ExecContext(ctx,
+				c.Moneda, c.Cotizacion, c.Purchase, nullIfZero(c.Ask), nullIfZero(c.TotalBid),
+				c.Datetime, c.Exchange, nullIfEmpty(c.MonedaDest), nullIfEmpty(c.SourceDatetime),
+			)
+			if err != nil {
+				return fmt.Errorf("error inserting %s/%s %s: %w", c.Moneda, c.Exchange, c.Datetime, err)
+			}
+			if n, _ := result.RowsAffected(); n > 0 {
+				inserted++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return inserted, rolledUp, nil
+}
@@ -0,0 +1,356 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MemStore is an in-memory Store for tests. It mirrors the SQLite semantics the
+// callers rely on: datetime is stamped on insert and missing rows return
+// sql.ErrNoRows. Fields are exported so tests can seed and inspect them.
+type MemStore struct {
+	mu            sync.Mutex
+	Cotizaciones  []Cotizacion
+	Quarantine    []QuarantinedCotizacion
+	Subscribers   []Subscriber
+	Notifications []Notification
+	Outbox        []OutboxMessage
+	Now           func() time.Time // reloj usado al insertar; time.Now si es nil
+	SkipUnchanged bool             // como Options.SkipUnchanged
+}
+
+// NewMemStore returns an empty MemStore.
+func NewMemStore() *MemStore {
+	return &MemStore{}
+}
+
+func (m *MemStore) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// InsertCotizacion stores c stamped with the current time, overwriting the row
+// with the same (moneda, exchange, datetime) like the SQLite upsert.
+func (m *MemStore) InsertCotizacion(ctx context.Context, c Cotizacion) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("error inserting cotizacion: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	c.Datetime = FormatTime(m.now())
+
+	latest := -1
+	for i, o := range m.Cotizaciones {
+		if o.Moneda == c.Moneda && o.Exchange == c.Exchange && (latest < 0 || o.Datetime >= m.Cotizaciones[latest].Datetime) {
+			latest = i
+		}
+	}
+	if latest >= 0 {
+		prev := m.Cotizaciones[latest]
+		if m.SkipUnchanged && prev.Cotizacion == c.Cotizacion && prev.Purchase == c.Purchase &&
+			prev.Ask == c.Ask && prev.TotalBid == c.TotalBid {
+			return false, nil
+		}
+		if prev.Datetime == c.Datetime {
+			m.Cotizaciones[latest] = c
+			return true, nil
+		}
+	}
+	m.Cotizaciones = append(m.Cotizaciones, c)
+	return true, nil
+}
+
+// InsertQuarantine stores a rejected sample.
+func (m *MemStore) InsertQuarantine(ctx context.Context, moneda, exchange string, bid, purchase float64, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error inserting quarantine: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.Quarantine = append(m.Quarantine, QuarantinedCotizacion{
+		Cotizacion: Cotizacion{Moneda: moneda, Cotizacion: bid, Purchase: purchase, Exchange: exchange, Datetime: FormatTime(m.now())},
+		Reason:     reason,
+	})
+	return nil
+}
+
+// GetLatestByMoneda returns the most recent cotizacion for moneda.
+func (m *MemStore) GetLatestByMoneda(ctx context.Context, name string) (Cotizacion, error) {
+	return m.latest(ctx, func(c Cotizacion) bool { return c.Moneda == name })
+}
+
+// GetLatestByExchange returns the most recent cotizacion for moneda on exchange.
+func (m *MemStore) GetLatestByExchange(ctx context.Context, name, exchange string) (Cotizacion, error) {
+	return m.latest(ctx, func(c Cotizacion) bool { return c.Moneda == name && c.Exchange == exchange })
+}
+
+// latest returns the newest row matching match; on equal datetime the last inserted wins.
+func (m *MemStore) latest(ctx context.Context, match func(Cotizacion) bool) (Cotizacion, error) {
+	if err := ctx.Err(); err != nil {
+		return Cotizacion{}, err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var best Cotizacion
+	found := false
+	for _, c := range m.Cotizaciones {
+		if match(c) && (!found || c.Datetime >= best.Datetime) {
+			best, found = c, true
+		}
+	}
+	if !found {
+		return Cotizacion{}, sql.ErrNoRows
+	}
+	return best, nil
+}
+
+// GetLatestSummary returns the latest quotes of every registered instrument.
+func (m *MemStore) GetLatestSummary(ctx context.Context) (map[string]Cotizacion, error) {
+	return latestSummary(ctx, m)
+}
+
+// GetRange returns the cotizaciones of moneda in [from, to), oldest first.
+func (m *MemStore) GetRange(ctx context.Context, moneda string, from, to time.Time) ([]Cotizacion, error) {
+	all, err := m.GetAllCotizaciones(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lo, hi := FormatTime(from), FormatTime(to)
+	var out []Cotizacion
+	for _, c := range all {
+		if c.Moneda == moneda && c.Datetime >= lo && c.Datetime < hi {
+			out = append(out, c)
+		}
+	}
+	return out, nil
+}
+
+// GetValueAt returns the last cotizacion of moneda on exchange at or before t.
+// The fake keeps no rollups, so only raw rows are considered.
+func (m *MemStore) GetValueAt(ctx context.Context, moneda, exchange string, t time.Time) (float64, error) {
+	at := FormatTime(t)
+	c, err := m.latest(ctx, func(c Cotizacion) bool {
+		return c.Moneda == moneda && c.Exchange == exchange && c.Datetime <= at
+	})
+	return c.Cotizacion, err
+}
+
+// GetAllCotizaciones returns every cotizacion ordered by datetime.
+func (m *MemStore) GetAllCotizaciones(ctx context.Context) ([]Cotizacion, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("error querying cotizaciones: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	out := slices.Clone(m.Cotizaciones)
+	slices.SortStableFunc(out, func(a, b Cotizacion) int {
+		switch {
+		case a.Datetime < b.Datetime:
+			return -1
+		case a.Datetime > b.Datetime:
+			return 1
+		}
+		return 0
+	})
+	return out, nil
+}
+
+// ExportCotizacionesToJSON writes every cotizacion to outputPath like the SQLite store.
+func (m *MemStore) ExportCotizacionesToJSON(ctx context.Context, outputPath string) error {
+	cotizaciones, err := m.GetAllCotizaciones(ctx)
+	if err != nil {
+		return err
+	}
+	return writeJSON(outputPath, cotizaciones)
+}
+
+// GetSubscribers returns copies of the enabled subscribers ordered by id.
+func (m *MemStore) GetSubscribers(ctx context.Context) ([]Subscriber, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("error querying subscribers: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Subscriber
+	for _, s := range m.Subscribers {
+		if s.Enabled {
+			s.Instruments = slices.Clone(s.Instruments)
+			out = append(out, s)
+		}
+	}
+	slices.SortFunc(out, func(a, b Subscriber) int { return int(a.ID - b.ID) })
+	return out, nil
+}
+
+// AddSubscriber appends s with the next id.
+func (m *MemStore) AddSubscriber(ctx context.Context, s Subscriber) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("error inserting subscriber: %w", err)
+	}
+	if s.ChatID == "" {
+		return 0, fmt.Errorf("subscriber chat ID vacío")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, o := range m.Subscribers {
+		if o.ChatID == s.ChatID {
+			return 0, fmt.Errorf("error inserting subscriber: chat %s ya existe", s.ChatID)
+		}
+		s.ID = max(s.ID, o.ID)
+	}
+	s.ID++
+	if s.SpikeThreshold <= 0 {
+		s.SpikeThreshold = 0.20
+	}
+	m.Subscribers = append(m.Subscribers, s)
+	return s.ID, nil
+}
+
+// UpdateSubscriber updates currentdate, messageid and both thresholds of a subscriber.
+func (m *MemStore) UpdateSubscriber(ctx context.Context, id int64, currentDate, messageID string, umbralUSDT, umbralRef float64) error {
+	return m.updateSubscriber(ctx, id, func(s *Subscriber) {
+		s.CurrentDate = sql.NullString{String: currentDate, Valid: true}
+		s.MessageID = sql.NullString{String: messageID, Valid: messageID != ""}
+		s.Umbral = sql.NullFloat64{Float64: umbralUSDT, Valid: true}
+		s.UmbralReferencial = sql.NullFloat64{Float64: umbralRef, Valid: true}
+	})
+}
+
+// UpdateSubscriberMessageID updates only currentdate and messageid of a subscriber.
+func (m *MemStore) UpdateSubscriberMessageID(ctx context.Context, id int64, currentDate, messageID string) error {
+	return m.updateSubscriber(ctx, id, func(s *Subscriber) {
+		s.CurrentDate = sql.NullString{String: currentDate, Valid: true}
+		s.MessageID = sql.NullString{String: messageID, Valid: messageID != ""}
+	})
+}
+
+func (m *MemStore) updateSubscriber(ctx context.Context, id int64, update func(*Subscriber)) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error updating subscriber %d: %w", id, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Subscribers {
+		if m.Subscribers[i].ID == id {
+			update(&m.Subscribers[i])
+			return nil
+		}
+	}
+	return fmt.Errorf("subscriber %d no existe", id)
+}
+
+// InsertNotification appends n to the audit log with the next id and the current time.
+func (m *MemStore) InsertNotification(ctx context.Context, n Notification) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error inserting notification: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n.ID = int64(len(m.Notifications) + 1)
+	n.Datetime = FormatTime(m.now())
+	m.Notifications = append(m.Notifications, n)
+	return nil
+}
+
+// EnqueueOutbox stores m as pending with the next id.
+func (m *MemStore) EnqueueOutbox(ctx context.Context, msg OutboxMessage) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("error enqueuing notification: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	msg.ID = int64(len(m.Outbox) + 1)
+	msg.CreatedAt = FormatTime(m.now())
+	msg.Status = OutboxPending
+	msg.Instruments = slices.Clone(msg.Instruments)
+	m.Outbox = append(m.Outbox, msg)
+	return msg.ID, nil
+}
+
+// GetPendingOutbox returns the pending messages, oldest first.
+func (m *MemStore) GetPendingOutbox(ctx context.Context) ([]OutboxMessage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("error querying outbox: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []OutboxMessage
+	for _, msg := range m.Outbox {
+		if msg.Status == OutboxPending {
+			msg.Instruments = slices.Clone(msg.Instruments)
+			out = append(out, msg)
+		}
+	}
+	return out, nil
+}
+
+// CompleteOutbox records the delivery result of a pending message.
+func (m *MemStore) CompleteOutbox(ctx context.Context, id int64, status OutboxStatus, sentMessageID int, errMsg string) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("error completing outbox %d: %w", id, err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.Outbox {
+		if msg := &m.Outbox[i]; msg.ID == id && msg.Status == OutboxPending {
+			msg.Status, msg.SentAt, msg.SentMessageID, msg.Error = status, FormatTime(m.now()), sentMessageID, errMsg
+			return nil
+		}
+	}
+	return fmt.Errorf("outbox %d no existe o ya fue completado", id)
+}
+
+// ExpireOutbox marks as expired the pending messages created before the given time.
+func (m *MemStore) ExpireOutbox(ctx context.Context, before time.Time) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, fmt.Errorf("error expiring outbox: %w", err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cutoff := FormatTime(before)
+	var n int64
+	for i := range m.Outbox {
+		if msg := &m.Outbox[i]; msg.Status == OutboxPending && msg.CreatedAt < cutoff {
+			msg.Status, msg.Error = OutboxExpired, "entrega no registrada, se vuelve a planificar"
+			n++
+		}
+	}
+	return n, nil
+}
+
+// WithTx runs fn against m and restores the previous contents if it fails.
+// There is no isolation: the fake is meant for single-goroutine tests.
+func (m *MemStore) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	m.mu.Lock()
+	snap := m.snapshot()
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.Cotizaciones, m.Quarantine = snap.Cotizaciones, snap.Quarantine
+		m.Subscribers, m.Notifications, m.Outbox = snap.Subscribers, snap.Notifications, snap.Outbox
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// snapshot copies the contents of m (called with mu held).
+func (m *MemStore) snapshot() *MemStore {
+	return &MemStore{
+		Cotizaciones:  slices.Clone(m.Cotizaciones),
+		Quarantine:    slices.Clone(m.Quarantine),
+		Subscribers:   slices.Clone(m.Subscribers),
+		Notifications: slices.Clone(m.Notifications),
+		Outbox:        slices.Clone(m.Outbox),
+	}
+}
+
+// Close is a no-op.
+func (m *MemStore) Close() error { return nil }
@@ -0,0 +1,330 @@
+package db
+
+import (
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migration is one embedded SQL file named NNNN_description.sql
+type migration struct {
+	Version int
+	Name    string
+	SQL     string
+}
+
+// column is a row of PRAGMA table_info
+type column struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Default sql.NullString
+}
+
+// loadMigrations returns the embedded migrations ordered by version.
+func loadMigrations() ([]migration, error) {
+	entries, err := fs.ReadDir(migrationsFS, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("error reading migrations: %w", err)
+	}
+
+	var out []migration
+	seen := make(map[int]string)
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || path.Ext(name) != ".sql" {
+			continue
+		}
+		prefix, _, ok := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if !ok || err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid name, expected NNNN_description.sql", name)
+		}
+		if prev, dup := seen[version]; dup {
+			return nil, fmt.Errorf("migration %s: version %d already used by %s", name, version, prev)
+		}
+		seen[version] = name
+
+		body, err := migrationsFS.ReadFile("migrations/" + name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", name, err)
+		}
+		out = append(out, migration{Version: version, Name: strings.TrimSuffix(name, ".sql"), SQL: string(body)})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// LatestSchemaVersion returns the version of the newest embedded migration.
+func LatestSchemaVersion() (int, error) {
+	ms, err := loadMigrations()
+	if err != nil {
+		return 0, err
+	}
+	if len(ms) == 0 {
+		return 0, nil
+	}
+	return ms[len(ms)-1].Version, nil
+}
+
+// migrate brings the database up to the latest embedded migration. Databases
+// created before the migration system (tables present, no schema_version) are
+// first completed with the baseline columns they lack, then stamped.
+func migrate(conn *sql.DB) error {
+	ms, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	legacy, err := isLegacy(conn)
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.Exec(`CREATE TABLE IF NOT EXISTS schema_version (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT NOT NULL,
+		applied_at TEXT NOT NULL
+	)`); err != nil {
+		return fmt.Errorf("error creating schema_version: %w", err)
+	}
+
+	if legacy && len(ms) > 0 {
+		if err := adoptLegacy(conn, ms[0]); err != nil {
+			return fmt.Errorf("error adopting legacy schema: %w", err)
+		}
+	}
+
+	current, err := schemaVersion(conn)
+	if err != nil {
+		return err
+	}
+
+	latest := 0
+	if len(ms) > 0 {
+		latest = ms[len(ms)-1].Version
+	}
+	if current > latest {
+		return fmt.Errorf("database schema version %d is newer than this binary (%d)", current, latest)
+	}
+
+	for _, m := range ms {
+		if m.Version <= current {
+			continue
+		}
+		if err := applyMigration(conn, m); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// applyMigration runs a migration and records it in a single transaction.
+func applyMigration(conn *sql.DB, m migration) error {
+	tx, err := conn.Begin()
+	if err != nil {
+		return fmt.Errorf("migration %s: error starting transaction: %w", m.Name, err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.SQL); err != nil {
+		return fmt.Errorf("migration %s failed: %w", m.Name, err)
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO schema_version (version, name, applied_at) VALUES (?, ?, ?)",
+		m.Version, m.Name, FormatTime(time.Now()),
+	); err != nil {
+		return fmt.Errorf("migration %s: error recording version: %w", m.Name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("migration %s: error committing: %w", m.Name, err)
+	}
+	return nil
+}
+
+// schemaVersion returns the highest applied migration, 0 if none.
+func schemaVersion(conn *sql.DB) (int, error) {
+	var v sql.NullInt64
+	if err := conn.QueryRow("SELECT MAX(version) FROM schema_version").Scan(&v); err != nil {
+		return 0, fmt.Errorf("error reading schema version: %w", err)
+	}
+	return int(v.Int64), nil
+}
+
+// isLegacy reports whether the database has the cotizaciones table but no schema_version.
+func isLegacy(conn *sql.DB) (bool, error) {
+	tables, err := tableNames(conn)
+	if err != nil {
+		return false, err
+	}
+	_, hasVersion := tables["schema_version"]
+	_, hasCotizaciones := tables["cotizaciones"]
+	return hasCotizaciones && !hasVersion, nil
+}
+
+// adoptLegacy adds to existing tables the columns the baseline migration declares,
+// replacing the old best-effort ALTER TABLE statements. The baseline itself is then
+// applied normally (its CREATE ... IF NOT EXISTS statements are no-ops for them).
+func adoptLegacy(conn *sql.DB, baseline migration) error {
+	ref, err := referenceSchema([]migration{baseline})
+	if err != nil {
+		return err
+	}
+	for table, refCols := range ref {
+		cols, err := tableColumns(conn, table)
+		if err != nil {
+			return err
+		}
+		if len(cols) == 0 {
+			continue // la tabla no existe; la crea la migración base
+		}
+		for _, rc := range refCols {
+			if _, ok := cols[rc.Name]; ok {
+				continue
+			}
+			if rc.NotNull && !rc.Default.Valid {
+				return fmt.Errorf("%s.%s is NOT NULL without default and cannot be added", table, rc.Name)
+			}
+			stmt := fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, rc.Name, rc.Type)
+			if rc.Default.Valid {
+				stmt += " DEFAULT " + rc.Default.String
+			}
+			if _, err := conn.Exec(stmt); err != nil {
+				return fmt.Errorf("error adding %s.%s: %w", table, rc.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// referenceSchema applies ms to an empty in-memory database and returns its tables and columns.
+func referenceSchema(ms []migration) (map[string][]column, error) {
+	mem, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return nil, fmt.Errorf("error opening reference database: %w", err)
+	}
+	defer mem.Close()
+	mem.SetMaxOpenConns(1)
+
+	for _, m := range ms {
+		if _, err := mem.Exec(m.SQL); err != nil {
+			return nil, fmt.Errorf("migration %s failed on empty database: %w", m.Name, err)
+		}
+	}
+
+	tables, err := tableNames(mem)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string][]column, len(tables))
+	for t := range tables {
+		cols, err := tableColumnList(mem, t)
+		if err != nil {
+			return nil, err
+		}
+		out[t] = cols
+	}
+	return out, nil
+}
+
+// CheckSchema compares the database against the schema produced by the embedded
+// migrations and reports missing tables or columns (schema drift).
+func (d *DB) CheckSchema() error {
+	ms, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+	ref, err := referenceSchema(ms)
+	if err != nil {
+		return err
+	}
+
+	var drift []string
+	for table, refCols := range ref {
+		cols, err := tableColumns(d.conn, table)
+		if err != nil {
+			return err
+		}
+		if len(cols) == 0 {
+			drift = append(drift, "missing table "+table)
+			continue
+		}
+		for _, rc := range refCols {
+			if _, ok := cols[rc.Name]; !ok {
+				drift = append(drift, fmt.Sprintf("missing column %s.%s", table, rc.Name))
+			}
+		}
+	}
+	if len(drift) > 0 {
+		sort.Strings(drift)
+		return fmt.Errorf("schema drift: %s", strings.Join(drift, ", "))
+	}
+	return nil
+}
+
+// SchemaVersion returns the highest migration applied to the database.
+func (d *DB) SchemaVersion() (int, error) {
+	return schemaVersion(d.conn)
+}
+
+// tableNames returns the user tables of the database.
+func tableNames(conn *sql.DB) (map[string]struct{}, error) {
+	rows, err := conn.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return nil, fmt.Errorf("error listing tables: %w", err)
+	}
+	defer rows.Close()
+
+	out := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("error scanning table name: %w", err)
+		}
+		out[name] = struct{}{}
+	}
+	return out, rows.Err()
+}
+
+// tableColumns returns the columns of table by name (empty if the table does not exist).
+func tableColumns(conn *sql.DB, table string) (map[string]column, error) {
+	list, err := tableColumnList(conn, table)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]column, len(list))
+	for _, c := range list {
+		out[c.Name] = c
+	}
+	return out, nil
+}
+
+// tableColumnList returns the columns of table in declaration order.
+func tableColumnList(conn *sql.DB, table string) ([]column, error) {
+	rows, err := conn.Query("SELECT name, type, \"notnull\", dflt_value FROM pragma_table_info(?)", table)
+	if err != nil {
+		return nil, fmt.Errorf("error reading columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	var out []column
+	for rows.Next() {
+		var c column
+		if err := rows.Scan(&c.Name, &c.Type, &c.NotNull, &c.Default); err != nil {
+			return nil, fmt.Errorf("error scanning column of %s: %w", table, err)
+		}
+		out = append(out, c)
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,31 @@
+-- Esquema base: crea las tablas si no existen (base de datos nueva).
+CREATE TABLE IF NOT EXISTS cotizaciones (
+	moneda          TEXT NOT NULL,
+	cotizacion      REAL,
+	purchase        REAL DEFAULT 0,
+	ask             REAL,
+	total_bid       REAL,
+	datetime        TEXT NOT NULL,
+	exchange        TEXT,
+	moneda_dest     TEXT,
+	source_datetime TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_cotizaciones_moneda_datetime ON cotizaciones (moneda, datetime);
+
+CREATE TABLE IF NOT EXISTS config (
+	currentdate        TEXT,
+	chatid             TEXT,
+	messageid          TEXT,
+	umbral             REAL,
+	umbral_referencial REAL
+);
+
+CREATE TABLE IF NOT EXISTS cotizaciones_quarantine (
+	moneda     TEXT NOT NULL,
+	cotizacion REAL,
+	purchase   REAL,
+	datetime   TEXT NOT NULL,
+	exchange   TEXT NOT NULL,
+	reason     TEXT NOT NULL
+);
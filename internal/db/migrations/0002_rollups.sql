@@ -0,0 +1,26 @@
+-- Agregados OHLC por hora y por día de las cotizaciones podadas.
+CREATE TABLE IF NOT EXISTS cotizaciones_hourly (
+	moneda   TEXT NOT NULL,
+	exchange TEXT NOT NULL DEFAULT '',
+	bucket   TEXT NOT NULL, -- inicio de la hora, formato 2006-01-02 15:00:00
+	open     REAL,
+	high     REAL,
+	low      REAL,
+	close    REAL,
+	avg      REAL,
+	samples  INTEGER NOT NULL,
+	PRIMARY KEY (moneda, exchange, bucket)
+);
+
+CREATE TABLE IF NOT EXISTS cotizaciones_daily (
+	moneda   TEXT NOT NULL,
+	exchange TEXT NOT NULL DEFAULT '',
+	bucket   TEXT NOT NULL, -- día, formato 2006-01-02
+	open     REAL,
+	high     REAL,
+	low      REAL,
+	close    REAL,
+	avg      REAL,
+	samples  INTEGER NOT NULL,
+	PRIMARY KEY (moneda, exchange, bucket)
+);
@@ -0,0 +1,21 @@
+-- Suscriptores de Telegram: cada chat/canal con su propio mensaje vivo, umbrales,
+-- selección de instrumentos y preferencia silenciosa.
+CREATE TABLE IF NOT EXISTS subscribers (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	chatid             TEXT NOT NULL UNIQUE,
+	name               TEXT NOT NULL DEFAULT '',
+	currentdate        TEXT,
+	messageid          TEXT,
+	umbral             REAL,
+	umbral_referencial REAL,
+	spike_threshold    REAL NOT NULL DEFAULT 0.20,
+	instruments        TEXT NOT NULL DEFAULT '', -- claves separadas por coma; vacío = todas
+	silent             INTEGER NOT NULL DEFAULT 0, -- 1: también los spikes se envían sin sonido
+	enabled            INTEGER NOT NULL DEFAULT 1
+);
+
+-- El chat de la tabla config pasa a ser el primer suscriptor.
+INSERT OR IGNORE INTO subscribers (chatid, name, currentdate, messageid, umbral, umbral_referencial)
+SELECT chatid, 'config', currentdate, messageid, umbral, umbral_referencial
+FROM config
+WHERE chatid IS NOT NULL AND chatid <> '';
@@ -0,0 +1,15 @@
+-- Registro de auditoría de cada envío/edición de Telegram.
+CREATE TABLE IF NOT EXISTS notifications (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	datetime           TEXT NOT NULL,
+	chatid             TEXT NOT NULL,
+	kind               TEXT NOT NULL, -- daily | spike | edit | fallback
+	messageid          INTEGER,
+	usdt               REAL,
+	usd_referencial    REAL,
+	umbral             REAL,
+	umbral_referencial REAL,
+	error              TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_datetime ON notifications (datetime);
@@ -0,0 +1,11 @@
+-- Regla de unicidad: una fila por (moneda, exchange, datetime).
+-- exchange pasa a ser '' en lugar de NULL para que la restricción también lo cubra.
+UPDATE cotizaciones SET exchange = '' WHERE exchange IS NULL;
+
+-- Conserva la última fila insertada de cada duplicado existente.
+DELETE FROM cotizaciones
+WHERE rowid NOT IN (
+	SELECT MAX(rowid) FROM cotizaciones GROUP BY moneda, exchange, datetime
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_cotizaciones_unique ON cotizaciones (moneda, exchange, datetime);
@@ -0,0 +1,9 @@
+-- Los timestamps se guardaban en hora local de Bolivia (UTC-4, sin horario de
+-- verano); desde ahora se guardan en UTC. Las fechas sin hora (publicación BCB,
+-- buckets diarios, currentdate) siguen siendo días de La Paz.
+--
+-- Esta migración desplazaba +4h todas las filas sin condición, lo que corría dos
+-- veces las ya escritas en UTC (p. ej. por pods con TZ=UTC). La conversión ahora
+-- es explícita: `cotizaciones shift-utc -offset 4h -before <primera fila en UTC>`
+-- (ver db.ShiftTimestamps). Las bases que ya la aplicaron no cambian.
+SELECT 1;
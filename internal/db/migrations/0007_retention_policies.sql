@@ -0,0 +1,18 @@
+-- Retención de cotizaciones crudas por moneda/exchange. Lo más específico gana:
+-- (moneda, exchange), luego (moneda, ''), luego ('*', '').
+CREATE TABLE IF NOT EXISTS retention_policies (
+	moneda         TEXT NOT NULL,            -- '*' = cualquier moneda
+	exchange       TEXT NOT NULL DEFAULT '', -- '' = cualquier exchange
+	retention_days INTEGER NOT NULL,         -- 0 = conservar siempre
+	PRIMARY KEY (moneda, exchange)
+);
+
+-- Ticks por minuto: 30 días como hasta ahora. Series BCB (un punto por día): sin límite.
+INSERT OR IGNORE INTO retention_policies (moneda, exchange, retention_days) VALUES
+	('*', '', 30),
+	('usd oficial', '', 0),
+	('usd referencial', '', 0),
+	('eur', '', 0),
+	('oro', '', 0),
+	('plata', '', 0),
+	('ufv', '', 0);
@@ -0,0 +1,29 @@
+-- Outbox de notificaciones: el mensaje a enviar se registra en la misma transacción
+-- que las cotizaciones y el estado de los suscriptores; se marca al entregarlo.
+--
+-- La entrega es at-least-once: se envía a Telegram y recién después se registra el
+-- resultado. Si el proceso muere entre ambos pasos la fila queda 'pending'; la
+-- corrida siguiente la marca 'expired' y vuelve a planificar al suscriptor con los
+-- precios de ese momento, así que el mismo aviso (incluido un spike) puede llegar
+-- dos veces, pero nunca con un texto viejo junto a una imagen nueva.
+CREATE TABLE IF NOT EXISTS outbox (
+	id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+	created_at         TEXT NOT NULL,
+	subscriber_id      INTEGER NOT NULL,
+	chatid             TEXT NOT NULL,
+	kind               TEXT NOT NULL,            -- daily | spike | edit
+	text               TEXT NOT NULL,
+	silent             INTEGER NOT NULL DEFAULT 1,
+	messageid          INTEGER,                  -- mensaje a editar (edit)
+	instruments        TEXT NOT NULL DEFAULT '',
+	usdt               REAL,
+	usd_referencial    REAL,
+	umbral             REAL,
+	umbral_referencial REAL,
+	status             TEXT NOT NULL DEFAULT 'pending', -- pending | sent | failed | expired
+	sent_at            TEXT,
+	sent_messageid     INTEGER,
+	error              TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_outbox_status ON outbox (status, id);
@@ -0,0 +1,7 @@
+-- Primer y último datetime (UTC) agregados en cada bucket, para poder fusionar
+-- filas tardías (p. ej. importadas) sin perder open/close. NULL en los buckets
+-- anteriores a esta migración: se conservan su open/close.
+ALTER TABLE cotizaciones_hourly ADD COLUMN first_at TEXT;
+ALTER TABLE cotizaciones_hourly ADD COLUMN last_at TEXT;
+ALTER TABLE cotizaciones_daily ADD COLUMN first_at TEXT;
+ALTER TABLE cotizaciones_daily ADD COLUMN last_at TEXT;
@@ -0,0 +1,2 @@
+-- Motivo de las notificaciones omitidas (kind = 'skipped'): por qué no se avisó.
+ALTER TABLE notifications ADD COLUMN reason TEXT NOT NULL DEFAULT '';
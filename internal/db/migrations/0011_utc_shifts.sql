@@ -0,0 +1,13 @@
+-- Conversiones a UTC de las filas guardadas en hora local antes de 0006, hechas
+-- con el subcomando shift-utc. Mientras haya cotizaciones anteriores a 0006 y
+-- ninguna fila aquí, el arranque avisa (ver DB.PendingUTCShift).
+-- offset_seconds = 0 registra que esas filas ya estaban en UTC: pods con TZ=UTC
+-- o bases que aplicaron la primera versión de 0006, que las desplazaba +4h.
+CREATE TABLE IF NOT EXISTS utc_shifts (
+	id             INTEGER PRIMARY KEY AUTOINCREMENT,
+	applied_at     TEXT NOT NULL,
+	offset_seconds INTEGER NOT NULL,
+	from_dt        TEXT NOT NULL DEFAULT '',
+	before_dt      TEXT NOT NULL,
+	shifted_rows   INTEGER NOT NULL DEFAULT 0
+);
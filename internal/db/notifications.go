@@ -0,0 +1,86 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// NotificationKind is what the notification step did with a subscriber's message.
+type NotificationKind string
+
+const (
+	NotifyDaily    NotificationKind = "daily"    // new daily message (no live message yet)
+	NotifySpike    NotificationKind = "spike"    // loud message because a threshold was crossed
+	NotifyEdit     NotificationKind = "edit"     // live message edited in place
+	NotifyFallback NotificationKind = "fallback" // new message because the edit failed
+	NotifySkipped  NotificationKind = "skipped"  // nothing sent; Reason says why
+)
+
+// Notification represents a row in the notifications audit log.
+type Notification struct {
+	ID                int64            `json:"id"`
+	Datetime          string           `json:"datetime"`
+	ChatID            string           `json:"chatid"`
+	Kind              NotificationKind `json:"kind"`
+	MessageID         int              `json:"messageid,omitempty"` // 0 if nothing was sent
+	USDT              float64          `json:"usdt"`
+	USDReferencial    float64          `json:"usd_referencial"`
+	Umbral            float64          `json:"umbral"`
+	UmbralReferencial float64          `json:"umbral_referencial"`
+	Error             string           `json:"error,omitempty"`  // empty on success
+	Reason            string           `json:"reason,omitempty"` // why nothing was sent (NotifySkipped)
+}
+
+// InsertNotification appends n to the audit log, stamped with the current time.
+func (d *DB) InsertNotification(ctx context.Context, n Notification) error {
+	var mID any
+	if n.MessageID != 0 {
+		mID = n.MessageID
+	}
+	_, err := d.q.ExecContext(ctx,
+		"INSERT INTO notifications (datetime, chatid, kind, messageid, usdt, usd_referencial, umbral, umbral_referencial, error, reason) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		FormatTime(time.Now()), n.ChatID, n.Kind, mID, n.USDT, n.USDReferencial, n.Umbral, n.UmbralReferencial, n.Error, n.Reason,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting notification: %w", err)
+	}
+	return nil
+}
+
+// GetNotifications returns the audit log in [from, to), oldest first. An empty
+// chatID returns every chat.
+func (d *DB) GetNotifications(ctx context.Context, chatID string, from, to time.Time) ([]Notification, error) {
+	query := "SELECT id, datetime, chatid, kind, messageid, usdt, usd_referencial, umbral, umbral_referencial, error, reason FROM notifications WHERE datetime >= ? AND datetime < ?"
+	args := []any{FormatTime(from), FormatTime(to)}
+	if chatID != "" {
+		query += " AND chatid = ?"
+		args = append(args, chatID)
+	}
+	query += " ORDER BY datetime ASC, id ASC"
+
+	rows, err := d.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Notification
+	for rows.Next() {
+		var n Notification
+		var mID sql.NullInt64
+		var usdt, ref, umbral, umbralRef sql.NullFloat64
+		if err := rows.Scan(&n.ID, &n.Datetime, &n.ChatID, &n.Kind, &mID, &usdt, &ref, &umbral, &umbralRef, &n.Error, &n.Reason); err != nil {
+			return nil, fmt.Errorf("error scanning notification: %w", err)
+		}
+		n.MessageID = int(mID.Int64)
+		n.USDT, n.USDReferencial = usdt.Float64, ref.Float64
+		n.Umbral, n.UmbralReferencial = umbral.Float64, umbralRef.Float64
+		out = append(out, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return out, nil
+}
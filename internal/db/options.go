@@ -0,0 +1,118 @@
+package db
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MemoryPath opens a private in-memory database (useful for tests and dry runs).
+const MemoryPath = ":memory:"
+
+// Options configures how the database is opened.
+type Options struct {
+	Path        string        // file path or MemoryPath
+	BusyTimeout time.Duration // how long to wait on a locked database
+	JournalMode string        // WAL, DELETE, TRUNCATE, MEMORY...; empty keeps SQLite's default
+	ReadOnly    bool          // open without write access and skip migrations
+	// SkipUnchanged makes InsertCotizacion write nothing when the prices equal
+	// the previous row of the same moneda/exchange.
+	SkipUnchanged bool
+}
+
+// DefaultOptions returns the production settings.
+func DefaultOptions() Options {
+	return Options{
+		Path:        dbPath,
+		BusyTimeout: 5 * time.Second,
+		JournalMode: "WAL",
+	}
+}
+
+// OptionsFromEnv returns DefaultOptions overridden by DB_PATH, DB_BUSY_TIMEOUT,
+// DB_JOURNAL_MODE, DB_READONLY and DB_SKIP_UNCHANGED.
+func OptionsFromEnv() (Options, error) {
+	o := DefaultOptions()
+	if v := os.Getenv("DB_PATH"); v != "" {
+		o.Path = v
+	}
+	if v := os.Getenv("DB_BUSY_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return o, fmt.Errorf("DB_BUSY_TIMEOUT inválido %q", v)
+		}
+		o.BusyTimeout = d
+	}
+	if v, ok := os.LookupEnv("DB_JOURNAL_MODE"); ok {
+		o.JournalMode = v
+	}
+	if v := os.Getenv("DB_READONLY"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("DB_READONLY inválido %q", v)
+		}
+		o.ReadOnly = b
+	}
+	if v := os.Getenv("DB_SKIP_UNCHANGED"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return o, fmt.Errorf("DB_SKIP_UNCHANGED inválido %q", v)
+		}
+		o.SkipUnchanged = b
+	}
+	return o, nil
+}
+
+// RegisterFlags binds the options to command line flags, using the current
+// values as defaults so flags override env.
+func (o *Options) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Path, "db", o.Path, "ruta de la base SQLite (\":memory:\" para base en memoria)")
+	fs.DurationVar(&o.BusyTimeout, "db-busy-timeout", o.BusyTimeout, "espera máxima con la base bloqueada")
+	fs.StringVar(&o.JournalMode, "db-journal-mode", o.JournalMode, "journal_mode de SQLite (WAL, DELETE, ...)")
+	fs.BoolVar(&o.ReadOnly, "db-readonly", o.ReadOnly, "abrir la base en solo lectura")
+	fs.BoolVar(&o.SkipUnchanged, "db-skip-unchanged", o.SkipUnchanged, "no guardar cotizaciones iguales a la anterior")
+}
+
+// InMemory reports whether the options select an in-memory database.
+func (o Options) InMemory() bool {
+	return o.Path == MemoryPath
+}
+
+// Validate checks the combination of options.
+func (o Options) Validate() error {
+	if o.Path == "" {
+		return fmt.Errorf("db path vacío")
+	}
+	if o.InMemory() && o.ReadOnly {
+		return fmt.Errorf("una base en memoria no puede abrirse en solo lectura")
+	}
+	if o.JournalMode != "" && strings.ContainsAny(o.JournalMode, "();'\" ") {
+		return fmt.Errorf("journal mode inválido %q", o.JournalMode)
+	}
+	return nil
+}
+
+// DSN returns the modernc.org/sqlite data source name for the options. Pragmas
+// are passed as _pragma parameters so they apply to every pooled connection.
+func (o Options) DSN() string {
+	q := url.Values{}
+	if o.BusyTimeout > 0 {
+		q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", o.BusyTimeout.Milliseconds()))
+	}
+	if o.JournalMode != "" && !o.ReadOnly {
+		q.Add("_pragma", fmt.Sprintf("journal_mode(%s)", o.JournalMode))
+	}
+	if o.ReadOnly {
+		q.Set("mode", "ro")
+	}
+
+	dsn := "file:" + o.Path
+	if len(q) > 0 {
+		dsn += "?" + q.Encode()
+	}
+	return dsn
+}
@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OutboxStatus is the delivery state of an outbox message.
+type OutboxStatus string
+
+const (
+	OutboxPending OutboxStatus = "pending"
+	OutboxSent    OutboxStatus = "sent"
+	OutboxFailed  OutboxStatus = "failed"
+	OutboxExpired OutboxStatus = "expired" // left pending by an earlier run, planned again
+)
+
+// OutboxMessage represents a row in the outbox: a Telegram notification decided
+// in the same transaction as the data that caused it, delivered afterwards.
+type OutboxMessage struct {
+	ID                int64
+	CreatedAt         string
+	SubscriberID      int64
+	ChatID            string
+	Kind              NotificationKind // NotifyDaily, NotifySpike or NotifyEdit
+	Text              string
+	Silent            bool
+	MessageID         int      // message to edit (NotifyEdit)
+	Instruments       []string // selection used for the image
+	USDT              float64  // prices and thresholds evaluated, for the audit log
+	USDReferencial    float64
+	Umbral            float64
+	UmbralReferencial float64
+	Status            OutboxStatus
+	SentAt            string
+	SentMessageID     int // message shown after delivery (new, fallback or edited)
+	Error             string
+}
+
+const outboxCols = "id, created_at, subscriber_id, chatid, kind, text, silent, messageid, instruments, usdt, usd_referencial, umbral, umbral_referencial, status, sent_at, sent_messageid, error"
+
+// EnqueueOutbox stores m as pending and returns its id.
+func (d *DB) EnqueueOutbox(ctx context.Context, m OutboxMessage) (int64, error) {
+	var mID any
+	if m.MessageID != 0 {
+		mID = m.MessageID
+	}
+	res, err := d.q.ExecContext(ctx,
+		`INSERT INTO outbox (created_at, subscriber_id, chatid, kind, text, silent, messageid, instruments, usdt, usd_referencial, umbral, umbral_referencial, status)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		FormatTime(time.Now()), m.SubscriberID, m.ChatID, m.Kind, m.Text, m.Silent, mID, strings.Join(m.Instruments, ","),
+		m.USDT, m.USDReferencial, m.Umbral, m.UmbralReferencial, OutboxPending,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error enqueuing notification: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// GetPendingOutbox returns the messages not yet delivered, oldest first.
+func (d *DB) GetPendingOutbox(ctx context.Context) ([]OutboxMessage, error) {
+	rows, err := d.q.QueryContext(ctx, "SELECT "+outboxCols+" FROM outbox WHERE status = ? ORDER BY id", OutboxPending)
+	if err != nil {
+		return nil, fmt.Errorf("error querying outbox: %w", err)
+	}
+	defer rows.Close()
+
+	var out []OutboxMessage
+	for rows.Next() {
+		var m OutboxMessage
+		var mID, sentID sql.NullInt64
+		var sentAt, instruments sql.NullString
+		var usdt, ref, umbral, umbralRef sql.NullFloat64
+		if err := rows.Scan(&m.ID, &m.CreatedAt, &m.SubscriberID, &m.ChatID, &m.Kind, &m.Text, &m.Silent, &mID, &instruments,
+			&usdt, &ref, &umbral, &umbralRef, &m.Status, &sentAt, &sentID, &m.Error); err != nil {
+			return nil, fmt.Errorf("error scanning outbox: %w", err)
+		}
+		m.MessageID, m.SentMessageID = int(mID.Int64), int(sentID.Int64)
+		m.Instruments = splitKeys(instruments.String)
+		m.USDT, m.USDReferencial = usdt.Float64, ref.Float64
+		m.Umbral, m.UmbralReferencial = umbral.Float64, umbralRef.Float64
+		m.SentAt = sentAt.String
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return out, nil
+}
+
+// CompleteOutbox records the delivery result of a pending message.
+func (d *DB) CompleteOutbox(ctx context.Context, id int64, status OutboxStatus, sentMessageID int, errMsg string) error {
+	var sID any
+	if sentMessageID != 0 {
+		sID = sentMessageID
+	}
+	res, err := d.q.ExecContext(ctx,
+		"UPDATE outbox SET status = ?, sent_at = ?, sent_messageid = ?, error = ? WHERE id = ? AND status = ?",
+		status, FormatTime(time.Now()), sID, errMsg, id, OutboxPending,
+	)
+	if err != nil {
+		return fmt.Errorf("error completing outbox %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("outbox %d no existe o ya fue completado", id)
+	}
+	return nil
+}
+
+// ExpireOutbox marks as expired the messages still pending that were queued
+// before the given time, i.e. by a run that did not record their delivery.
+// It returns how many were expired.
+func (d *DB) ExpireOutbox(ctx context.Context, before time.Time) (int64, error) {
+	res, err := d.q.ExecContext(ctx,
+		"UPDATE outbox SET status = ?, error = ? WHERE status = ? AND created_at < ?",
+		OutboxExpired, "entrega no registrada, se vuelve a planificar", OutboxPending, FormatTime(before),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error expiring outbox: %w", err)
+	}
+	return res.RowsAffected()
+}
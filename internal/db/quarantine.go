@@ -0,0 +1,54 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// QuarantinedCotizacion represents a rejected sample stored in cotizaciones_quarantine
+type QuarantinedCotizacion struct {
+	Cotizacion
+	Reason string `json:"reason"`
+}
+
+// InsertQuarantine stores a rejected sample instead of inserting it into cotizaciones.
+func (d *DB) InsertQuarantine(ctx context.Context, moneda, exchange string, bid, purchase float64, reason string) error {
+	datetime := FormatTime(time.Now())
+
+	_, err := d.q.ExecContext(ctx,
+		"INSERT INTO cotizaciones_quarantine (moneda, cotizacion, purchase, datetime, exchange, reason) VALUES (?, ?, ?, ?, ?, ?)",
+		moneda, bid, purchase, datetime, exchange, reason,
+	)
+	if err != nil {
+		return fmt.Errorf("error inserting quarantine: %w", err)
+	}
+
+	return nil
+}
+
+// GetQuarantine returns the most recent rejected samples, newest first.
+func (d *DB) GetQuarantine(ctx context.Context, limit int) ([]QuarantinedCotizacion, error) {
+	rows, err := d.q.QueryContext(ctx,
+		"SELECT moneda, cotizacion, purchase, datetime, exchange, reason FROM cotizaciones_quarantine ORDER BY datetime DESC LIMIT ?",
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying quarantine: %w", err)
+	}
+	defer rows.Close()
+
+	var out []QuarantinedCotizacion
+	for rows.Next() {
+		var q QuarantinedCotizacion
+		if err := rows.Scan(&q.Moneda, &q.Cotizacion.Cotizacion, &q.Purchase, &q.Datetime, &q.Exchange, &q.Reason); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		out = append(out, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return out, nil
+}
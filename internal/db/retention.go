@@ -0,0 +1,137 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// AnyMoneda is the retention_policies moneda that applies to every moneda.
+const AnyMoneda = "*"
+
+// RetentionPolicy represents a row in retention_policies.
+type RetentionPolicy struct {
+	Moneda        string `json:"moneda"`   // AnyMoneda for the default
+	Exchange      string `json:"exchange"` // empty for every exchange
+	RetentionDays int    `json:"retention_days"`
+}
+
+// Keep reports whether the policy keeps raw rows forever.
+func (p RetentionPolicy) Keep() bool {
+	return p.RetentionDays <= 0
+}
+
+// PruneResult reports what PruneByPolicy did for one moneda/exchange.
+type PruneResult struct {
+	Moneda   string
+	Exchange string
+	Policy   RetentionPolicy // policy that matched
+	RollupResult
+}
+
+// GetRetentionPolicies returns every policy ordered by moneda and exchange.
+func (d *DB) GetRetentionPolicies(ctx context.Context) ([]RetentionPolicy, error) {
+	rows, err := d.q.QueryContext(ctx, "SELECT moneda, exchange, retention_days FROM retention_policies ORDER BY moneda, exchange")
+	if err != nil {
+		return nil, fmt.Errorf("error querying retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	var out []RetentionPolicy
+	for rows.Next() {
+		var p RetentionPolicy
+		if err := rows.Scan(&p.Moneda, &p.Exchange, &p.RetentionDays); err != nil {
+			return nil, fmt.Errorf("error scanning retention policy: %w", err)
+		}
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetRetentionPolicy creates or replaces the policy of p.Moneda/p.Exchange.
+func (d *DB) SetRetentionPolicy(ctx context.Context, p RetentionPolicy) error {
+	if p.Moneda == "" {
+		return fmt.Errorf("retention policy: moneda vacía (use %q para todas)", AnyMoneda)
+	}
+	_, err := d.q.ExecContext(ctx,
+		"INSERT INTO retention_policies (moneda, exchange, retention_days) VALUES (?, ?, ?) ON CONFLICT (moneda, exchange) DO UPDATE SET retention_days = excluded.retention_days",
+		p.Moneda, p.Exchange, p.RetentionDays,
+	)
+	if err != nil {
+		return fmt.Errorf("error saving retention policy: %w", err)
+	}
+	return nil
+}
+
+// matchPolicy returns the most specific policy for moneda/exchange.
+func matchPolicy(policies []RetentionPolicy, moneda, exchange string) (RetentionPolicy, bool) {
+	for _, key := range [][2]string{{moneda, exchange}, {moneda, ""}, {AnyMoneda, ""}} {
+		for _, p := range policies {
+			if p.Moneda == key[0] && p.Exchange == key[1] {
+				return p, true
+			}
+		}
+	}
+	return RetentionPolicy{}, false
+}
+
+// PruneByPolicy rolls up and deletes, for every moneda/exchange stored in
+// cotizaciones, the raw rows older than its retention policy, in a single
+// transaction. Series without a matching policy or with Keep() are left intact
+// and not reported.
+func (d *DB) PruneByPolicy(ctx context.Context) ([]PruneResult, error) {
+	policies, err := d.GetRetentionPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []PruneResult
+	err = d.withTx(ctx, func(t *DB) error {
+		series, err := t.listSeries(ctx)
+		if err != nil {
+			return err
+		}
+		for _, s := range series {
+			p, ok := matchPolicy(policies, s[0], s[1])
+			if !ok || p.Keep() {
+				continue
+			}
+			cutoff := retentionCutoff(time.Duration(p.RetentionDays) * 24 * time.Hour)
+			res, err := t.rollupAndPrune(ctx, cutoff, "moneda = ? AND COALESCE(exchange, '') = ?", s[0], s[1])
+			if err != nil {
+				return fmt.Errorf("%s/%s: %w", s[0], s[1], err)
+			}
+			out = append(out, PruneResult{Moneda: s[0], Exchange: s[1], Policy: p, RollupResult: res})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// listSeries returns the distinct moneda/exchange pairs stored in cotizaciones.
+func (d *DB) listSeries(ctx context.Context) ([][2]string, error) {
+	rows, err := d.q.QueryContext(ctx, "SELECT DISTINCT moneda, COALESCE(exchange, '') FROM cotizaciones ORDER BY 1, 2")
+	if err != nil {
+		return nil, fmt.Errorf("error listing series: %w", err)
+	}
+	defer rows.Close()
+
+	var series [][2]string
+	for rows.Next() {
+		var s [2]string
+		if err := rows.Scan(&s[0], &s[1]); err != nil {
+			return nil, fmt.Errorf("error scanning series: %w", err)
+		}
+		series = append(series, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return series, nil
+}
@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// OHLC is an aggregated open/high/low/close bucket of cotizacion values
+type OHLC struct {
+	Moneda   string  `json:"moneda"`
+	Exchange string  `json:"exchange"`
+	Bucket   string  `json:"bucket"`
+	Open     float64 `json:"open"`
+	High     float64 `json:"high"`
+	Low      float64 `json:"low"`
+	Close    float64 `json:"close"`
+	Avg      float64 `json:"avg"`
+	Samples  int64   `json:"samples"`
+}
+
+// RollupResult reports what RollupAndPrune did
+type RollupResult struct {
+	Cutoff  string // raw rows strictly older than this (UTC) were rolled up and deleted
+	Hourly  int64  // hourly buckets written
+	Daily   int64  // daily buckets written
+	Deleted int64  // raw rows deleted
+}
+
+// Los buckets horarios son horas UTC como los datetime crudos; los diarios son días de La Paz.
+const hourBucketExpr = "strftime('%Y-%m-%d %H:00:00', datetime)"
+
+var dayBucketExpr = "strftime('%Y-%m-%d', datetime, '" + localModifier + "')"
+
+// ohlcQuery returns a SELECT producing (moneda, exchange, bucket, open, high, low,
+// close, avg, samples) from cotizaciones grouped by bucketExpr, for rows matching
+// where (which may use ? placeholders).
+func ohlcQuery(bucketExpr, where string) string {
+	return ohlcSelect(bucketExpr, where, "")
+}
+
+// ohlcSelect is ohlcQuery with extra aggregate columns appended to the SELECT.
+func ohlcSelect(bucketExpr, where, extra string) string {
+	return fmt.Sprintf(`SELECT moneda, exchange, bucket,
+		MAX(CASE WHEN rn_asc = 1 THEN cotizacion END),
+		MAX(cotizacion), MIN(cotizacion),
+		MAX(CASE WHEN rn_desc = 1 THEN cotizacion END),
+		AVG(cotizacion), COUNT(*)%[3]s
+	FROM (
+		SELECT moneda, COALESCE(exchange, '') AS exchange, %[1]s AS bucket, cotizacion, datetime,
+			ROW_NUMBER() OVER (PARTITION BY moneda, COALESCE(exchange, ''), %[1]s ORDER BY datetime ASC) AS rn_asc,
+			ROW_NUMBER() OVER (PARTITION BY moneda, COALESCE(exchange, ''), %[1]s ORDER BY datetime DESC) AS rn_desc
+		FROM cotizaciones
+		WHERE (%[2]s) AND %[1]s IS NOT NULL AND cotizacion IS NOT NULL
+	)
+	GROUP BY moneda, exchange, bucket`, bucketExpr, where, extra)
+}
+
+// rollupMerge folds a newly aggregated bucket (excluded) into an existing one:
+// extremes and sample-weighted average combine, open/close come from whichever
+// side holds the earliest/latest row. Buckets without first_at/last_at (rolled
+// up before they were recorded) keep their open/close. SET expressions see the
+// old row, so the order of the assignments does not matter.
+const rollupMerge = ` ON CONFLICT (moneda, exchange, bucket) DO UPDATE SET
+	open     = CASE WHEN first_at IS NOT NULL AND excluded.first_at < first_at THEN excluded.open ELSE open END,
+	first_at = CASE WHEN first_at IS NOT NULL AND excluded.first_at < first_at THEN excluded.first_at ELSE first_at END,
+	close    = CASE WHEN last_at IS NOT NULL AND excluded.last_at > last_at THEN excluded.close ELSE close END,
+	last_at  = CASE WHEN last_at IS NOT NULL AND excluded.last_at > last_at THEN excluded.last_at ELSE last_at END,
+	high     = MAX(high, excluded.high),
+	low      = MIN(low, excluded.low),
+	avg      = (avg * samples + excluded.avg * excluded.samples) / (samples + excluded.samples),
+	samples  = samples + excluded.samples`
+
+// RollupAndPrune aggregates raw cotizaciones older than retention into the hourly
+// and daily OHLC tables (merging with buckets already there) and then deletes
+// them, in a single transaction. The cutoff
+// is aligned to the start of the day in Location so every rolled up bucket is complete.
+func (d *DB) RollupAndPrune(ctx context.Context, retention time.Duration) (RollupResult, error) {
+	var res RollupResult
+	err := d.withTx(ctx, func(t *DB) error {
+		var err error
+		res, err = t.rollupAndPrune(ctx, retentionCutoff(retention), "")
+		return err
+	})
+	return res, err
+}
+
+// retentionCutoff returns now - retention aligned to the start of that day in Location.
+func retentionCutoff(retention time.Duration) string {
+	t := time.Now().Add(-retention).In(Location)
+	return FormatTime(time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, Location))
+}
+
+// rollupAndPrune aggregates and deletes the raw rows older than cutoff that also
+// match where (empty for all rows; may use ? placeholders bound to args), archiving
+// them first if an archiver is set. Callers run it inside a transaction.
+func (d *DB) rollupAndPrune(ctx context.Context, cutoff, where string, args ...any) (RollupResult, error) {
+	res := RollupResult{Cutoff: cutoff}
+	cond := "datetime < ?"
+	if where != "" {
+		cond += " AND " + where
+	}
+	args = append([]any{cutoff}, args...)
+
+	for _, r := range []struct {
+		table string
+		expr  string
+		count *int64
+	}{
+		{"cotizaciones_hourly", hourBucketExpr, &res.Hourly},
+		{"cotizaciones_daily", dayBucketExpr, &res.Daily},
+	} {
+		result, err := d.q.ExecContext(ctx,
+			"INSERT INTO "+r.table+" (moneda, exchange, bucket, open, high, low, close, avg, samples, first_at, last_at) "+
+				ohlcSelect(r.expr, cond, ", MIN(datetime), MAX(datetime)")+rollupMerge,
+			args...,
+		)
+		if err != nil {
+			return res, fmt.Errorf("error rolling up into %s: %w", r.table, err)
+		}
+		*r.count, _ = result.RowsAffected()
+	}
+
+	deleted, err := d.deleteCotizaciones(ctx, cond, args...)
+	if err != nil {
+		return res, err
+	}
+	res.Deleted = deleted
+	return res, nil
+}
+
+// GetDailyOHLC returns the daily buckets of a moneda (all exchanges if exchange is empty), oldest first.
+func (d *DB) GetDailyOHLC(ctx context.Context, moneda, exchange string) ([]OHLC, error) {
+	return d.queryOHLC(ctx, "cotizaciones_daily", moneda, exchange)
+}
+
+// GetHourlyOHLC returns the hourly buckets of a moneda (all exchanges if exchange is empty), oldest first.
+func (d *DB) GetHourlyOHLC(ctx context.Context, moneda, exchange string) ([]OHLC, error) {
+	return d.queryOHLC(ctx, "cotizaciones_hourly", moneda, exchange)
+}
+
+func (d *DB) queryOHLC(ctx context.Context, table, moneda, exchange string) ([]OHLC, error) {
+	query := "SELECT moneda, exchange, bucket, open, high, low, close, avg, samples FROM " + table + " WHERE moneda = ?"
+	args := []any{moneda}
+	if exchange != "" {
+		query += " AND exchange = ?"
+		args = append(args, exchange)
+	}
+	query += " ORDER BY bucket ASC, exchange ASC"
+
+	return d.queryOHLCRows(ctx, query, args...)
+}
+
+// queryOHLCRows runs a query selecting (moneda, exchange, bucket, open, high, low,
+// close, avg, samples) and collects the rows.
+func (d *DB) queryOHLCRows(ctx context.Context, query string, args ...any) ([]OHLC, error) {
+	rows, err := d.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying OHLC: %w", err)
+	}
+	defer rows.Close()
+
+	var out []OHLC
+	for rows.Next() {
+		var o OHLC
+		if err := rows.Scan(&o.Moneda, &o.Exchange, &o.Bucket, &o.Open, &o.High, &o.Low, &o.Close, &o.Avg, &o.Samples); err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		out = append(out, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return out, nil
+}
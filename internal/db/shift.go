@@ -0,0 +1,159 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// utcMigration is the migration after which timestamps are stored in UTC.
+const utcMigration = 6
+
+// ShiftResult counts the rows moved by ShiftTimestamps, per table.
+type ShiftResult struct {
+	Cotizaciones  int64
+	Quarantine    int64
+	Notifications int64
+	Hourly        int64 // hourly buckets
+}
+
+// UTCCutoff returns when migration 0006 was applied (UTC, storage format): rows
+// written before it by the old code are in local time unless a shift was
+// recorded (see PendingUTCShift).
+func (d *DB) UTCCutoff(ctx context.Context) (string, error) {
+	var at string
+	err := d.q.QueryRowContext(ctx, "SELECT applied_at FROM schema_version WHERE version = ?", utcMigration).Scan(&at)
+	if err != nil {
+		return "", fmt.Errorf("error reading migration %d: %w", utcMigration, err)
+	}
+	return at, nil
+}
+
+// PendingUTCShift returns how many cotizaciones predate the UTC cutoff while no
+// shift has been recorded in utc_shifts, and the cutoff itself. Those rows may
+// still be in local time: see ShiftTimestamps and MarkUTCShift.
+func (d *DB) PendingUTCShift(ctx context.Context) (int64, string, error) {
+	cutoff, err := d.UTCCutoff(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	var id int64
+	err = d.q.QueryRowContext(ctx, "SELECT id FROM utc_shifts LIMIT 1").Scan(&id)
+	if err == nil {
+		return 0, cutoff, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return 0, "", fmt.Errorf("error reading utc_shifts: %w", err)
+	}
+	var n int64
+	if err := d.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM cotizaciones WHERE datetime < ?", cutoff).Scan(&n); err != nil {
+		return 0, "", fmt.Errorf("error counting cotizaciones before %s: %w", cutoff, err)
+	}
+	return n, cutoff, nil
+}
+
+// MarkUTCShift records that the rows before the cutoff are already in UTC
+// (offset 0), without touching them.
+func (d *DB) MarkUTCShift(ctx context.Context, before string) error {
+	return d.recordShift(ctx, 0, "", before, 0)
+}
+
+func (d *DB) recordShift(ctx context.Context, offset time.Duration, from, before string, rows int64) error {
+	_, err := d.q.ExecContext(ctx,
+		"INSERT INTO utc_shifts (applied_at, offset_seconds, from_dt, before_dt, shifted_rows) VALUES (?, ?, ?, ?, ?)",
+		FormatTime(time.Now()), int64(offset/time.Second), from, before, rows)
+	if err != nil {
+		return fmt.Errorf("error recording utc shift: %w", err)
+	}
+	return nil
+}
+
+// ShiftTimestamps adds offset to the datetimes stored in [from, before), as
+// stored, for databases that were written in local time before the switch to
+// UTC (e.g. offset 4h for rows in La Paz time), and records it in utc_shifts.
+// offset must be whole hours and from may be empty. The range must only cover
+// local-time rows: rows already in UTC would be shifted twice.
+// Dates without time (daily buckets, BCB publication days, currentdate) are
+// days of La Paz and stay as they are. With dryRun only the rows are counted.
+func (d *DB) ShiftTimestamps(ctx context.Context, offset time.Duration, from, before string, dryRun bool) (ShiftResult, error) {
+	var res ShiftResult
+	// en horas enteras los buckets horarios desplazados siguen alineados
+	if offset == 0 || offset%time.Hour != 0 {
+		return res, fmt.Errorf("offset inválido %s: debe ser un número entero de horas distinto de cero", offset)
+	}
+	if from != "" {
+		if _, err := ParseTime(from); err != nil {
+			return res, fmt.Errorf("from inválido %q (formato %s): %w", from, timeFmt, err)
+		}
+	}
+	if _, err := ParseTime(before); err != nil {
+		return res, fmt.Errorf("before inválido %q (formato %s): %w", before, timeFmt, err)
+	}
+	if from >= before {
+		return res, fmt.Errorf("rango vacío: from %q no es anterior a before %q", from, before)
+	}
+
+	mod := fmt.Sprintf("%+d hours", int64(offset/time.Hour))
+	inRange := func(col string) string {
+		return fmt.Sprintf("%[1]s >= ?1 AND %[1]s < ?2 AND length(%[1]s) > 10 AND datetime(%[1]s) IS NOT NULL", col)
+	}
+
+	err := d.withTx(ctx, func(t *DB) error {
+		for _, c := range []struct {
+			n     *int64
+			table string
+			col   string
+		}{
+			{&res.Cotizaciones, "cotizaciones", "datetime"},
+			{&res.Quarantine, "cotizaciones_quarantine", "datetime"},
+			{&res.Notifications, "notifications", "datetime"},
+			{&res.Hourly, "cotizaciones_hourly", "bucket"},
+		} {
+			if err := t.q.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+c.table+" WHERE "+inRange(c.col), from, before).Scan(c.n); err != nil {
+				return fmt.Errorf("error counting %s: %w", c.table, err)
+			}
+		}
+		if dryRun {
+			return nil
+		}
+
+		// ranged marca las sentencias que filtran por el rango y llevan sus argumentos
+		stmts := []struct {
+			sql    string
+			ranged bool
+		}{
+			// El índice único se recrea al final: desplazar fila por fila podría chocar
+			// transitoriamente con otra fila aún no actualizada.
+			{"DROP INDEX IF EXISTS idx_cotizaciones_unique", false},
+			{`UPDATE cotizaciones SET
+				source_datetime = CASE WHEN length(source_datetime) > 10 AND datetime(source_datetime) IS NOT NULL
+					THEN datetime(source_datetime, '` + mod + `') ELSE source_datetime END,
+				datetime = datetime(datetime, '` + mod + `')
+			WHERE ` + inRange("datetime"), true},
+			{"CREATE UNIQUE INDEX IF NOT EXISTS idx_cotizaciones_unique ON cotizaciones (moneda, exchange, datetime)", false},
+			{"UPDATE cotizaciones_quarantine SET datetime = datetime(datetime, '" + mod + "') WHERE " + inRange("datetime"), true},
+			{"UPDATE notifications SET datetime = datetime(datetime, '" + mod + "') WHERE " + inRange("datetime"), true},
+			// la clave primaria de los buckets no se puede desactivar: se reinsertan desplazados
+			{"CREATE TEMP TABLE shift_hourly AS SELECT * FROM cotizaciones_hourly WHERE " + inRange("bucket"), true},
+			{"DELETE FROM cotizaciones_hourly WHERE " + inRange("bucket"), true},
+			{`INSERT INTO cotizaciones_hourly (moneda, exchange, bucket, open, high, low, close, avg, samples, first_at, last_at)
+			SELECT moneda, exchange, datetime(bucket, '` + mod + `'), open, high, low, close, avg, samples,
+				datetime(first_at, '` + mod + `'), datetime(last_at, '` + mod + `')
+			FROM shift_hourly`, false},
+			{"DROP TABLE shift_hourly", false},
+		}
+		for _, s := range stmts {
+			var args []any
+			if s.ranged {
+				args = []any{from, before}
+			}
+			if _, err := t.q.ExecContext(ctx, s.sql, args...); err != nil {
+				return fmt.Errorf("error shifting timestamps (¿el rango incluye filas ya en UTC?): %w", err)
+			}
+		}
+		return t.recordShift(ctx, offset, from, before, res.Cotizaciones)
+	})
+	return res, err
+}
@@ -1,21 +1,23 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
+	"cotizaciones/internal/instrument"
+
 	_ "modernc.org/sqlite"
 )
 
 const (
-	dbPath   = "/opt/osbo/datausd"
-	moneda   = "USDT"
-	exchange = "binancep2p"
-	timeFmt  = "2006-01-02 15:04:05"
+	dbPath  = "/opt/osbo/datausd" // ruta por defecto, ver Options
+	timeFmt = "2006-01-02 15:04:05"
 
 	// TimeFmt es el formato de almacenamiento en DB (exportado para uso en otros paquetes)
 	TimeFmt = timeFmt
@@ -25,14 +27,92 @@ const (
 	DisplayDateFmt = "02/01/2006"
 )
 
-// Cotizacion represents a row in the cotizaciones table
+// Cotizacion represents a row in the cotizaciones table.
+// For CriptoYa rows Cotizacion is the bid and Purchase the totalAsk; Ask and
+// TotalBid complete the payload (zero when the source does not provide them).
 type Cotizacion struct {
 	Moneda     string  `json:"moneda"`
 	Cotizacion float64 `json:"cotizacion"`
 	Purchase   float64 `json:"purchase"`
+	Ask        float64 `json:"ask,omitempty"`
+	TotalBid   float64 `json:"total_bid,omitempty"`
 	Datetime   string  `json:"datetime"`
 	Exchange   string  `json:"exchange"`
 	MonedaDest string  `json:"moneda_dest,omitempty"` // para futuras conversiones
+	// SourceDatetime es la hora reportada por la fuente; Datetime es la hora de ingesta.
+	SourceDatetime string `json:"source_datetime,omitempty"`
+}
+
+// RawSpread returns ask − bid, both without fees (Ask and Cotizacion).
+func (c Cotizacion) RawSpread() float64 {
+	return c.Ask - c.Cotizacion
+}
+
+// RawSpreadPct returns RawSpread as a percentage of the bid, or 0 if the bid is unknown.
+func (c Cotizacion) RawSpreadPct() float64 {
+	if c.Cotizacion == 0 {
+		return 0
+	}
+	return c.RawSpread() / c.Cotizacion * 100
+}
+
+// AllInSpread returns totalAsk − totalBid, both with fees (Purchase and TotalBid).
+func (c Cotizacion) AllInSpread() float64 {
+	return c.Purchase - c.TotalBid
+}
+
+// AllInSpreadPct returns AllInSpread as a percentage of the total bid, or 0 if it is unknown.
+func (c Cotizacion) AllInSpreadPct() float64 {
+	if c.TotalBid == 0 {
+		return 0
+	}
+	return c.AllInSpread() / c.TotalBid * 100
+}
+
+// cotizacionCols is the column list read by scanCotizacion, in order.
+const cotizacionCols = "moneda, cotizacion, purchase, ask, total_bid, datetime, exchange, moneda_dest, source_datetime"
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanCotizacion scans a row selected with cotizacionCols.
+func scanCotizacion(r rowScanner) (Cotizacion, error) {
+	var c Cotizacion
+	var md, st sql.NullString
+	var ask, totalBid sql.NullFloat64
+	if err := r.Scan(&c.Moneda, &c.Cotizacion, &c.Purchase, &ask, &totalBid, &c.Datetime, &c.Exchange, &md, &st); err != nil {
+		return Cotizacion{}, err
+	}
+	c.Ask = ask.Float64
+	c.TotalBid = totalBid.Float64
+	c.MonedaDest = md.String
+	c.SourceDatetime = st.String
+	return c, nil
+}
+
+// queryCotizaciones runs a query selecting cotizacionCols and collects the rows.
+func (d *DB) queryCotizaciones(ctx context.Context, query string, args ...any) ([]Cotizacion, error) {
+	rows, err := d.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying cotizaciones: %w", err)
+	}
+	defer rows.Close()
+
+	var cotizaciones []Cotizacion
+	for rows.Next() {
+		c, err := scanCotizacion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row: %w", err)
+		}
+		cotizaciones = append(cotizaciones, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+
+	return cotizaciones, nil
 }
 
 // Config represents a row in the config table
@@ -46,88 +126,176 @@ type Config struct {
 
 // DB wraps the sql.DB connection
 type DB struct {
-	conn *sql.DB
+	conn          *sql.DB
+	q             querier // conn, or tx inside WithTx
+	tx            *sql.Tx
+	skipUnchanged bool
+	archive       ArchiveFunc // see SetArchiver
+}
+
+// querier is implemented by *sql.DB and *sql.Tx.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
 }
 
-// New opens the SQLite database connection and applies performance pragmas
-func New() (*DB, error) {
-	conn, err := sql.Open("sqlite", dbPath)
+// New opens the SQLite database described by opts, applies its pragmas and
+// migrates the schema (unless opened read-only).
+func New(opts Options) (*DB, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid database options: %w", err)
+	}
+
+	conn, err := sql.Open("sqlite", opts.DSN())
 	if err != nil {
 		return nil, fmt.Errorf("error opening database: %w", err)
 	}
+	if opts.InMemory() {
+		// Cada conexión a :memory: es una base distinta: forzamos una sola.
+		conn.SetMaxOpenConns(1)
+	}
 
 	if err := conn.Ping(); err != nil {
 		return nil, fmt.Errorf("error connecting to database: %w", err)
 	}
 
-	// Enable WAL mode for better concurrent read/write performance
-	if _, err := conn.Exec("PRAGMA journal_mode=WAL"); err != nil {
-		return nil, fmt.Errorf("error setting WAL mode: %w", err)
+	if opts.ReadOnly {
+		d := &DB{conn: conn, q: conn, skipUnchanged: opts.SkipUnchanged}
+		if err := d.CheckSchema(); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+
+	// Create or upgrade the schema
+	if err := migrate(conn); err != nil {
+		return nil, fmt.Errorf("error migrating database: %w", err)
 	}
 
-	// Ensure 'purchase' column exists (migration)
-	_, _ = conn.Exec("ALTER TABLE cotizaciones ADD COLUMN purchase REAL DEFAULT 0")
-	// Ensure 'umbral_referencial' column exists (migration)
-	_, _ = conn.Exec("ALTER TABLE config ADD COLUMN umbral_referencial REAL")
+	d := &DB{conn: conn, q: conn, skipUnchanged: opts.SkipUnchanged}
+	if err := d.CheckSchema(); err != nil {
+		return nil, err
+	}
 
-	return &DB{conn: conn}, nil
+	return d, nil
 }
 
-// Close closes the database connection
+// Close closes the database connection. Inside WithTx it is a no-op.
 func (d *DB) Close() error {
+	if d.tx != nil {
+		return nil
+	}
 	return d.conn.Close()
 }
 
-// InsertCotizacion inserts a new cotizacion record.
-// Uses current local time to avoid duplicate key errors when the API
-// returns the same cached timestamp across consecutive calls.
-func (d *DB) InsertCotizacion(bid, purchase float64) error {
-	datetime := time.Now().Format(timeFmt)
+// WithTx runs fn as a unit of work: every Store call made through tx commits
+// together when fn returns nil and is rolled back otherwise. Nested calls join
+// the outer transaction.
+func (d *DB) WithTx(ctx context.Context, fn func(tx Store) error) error {
+	return d.withTx(ctx, func(t *DB) error { return fn(t) })
+}
 
-	_, err := d.conn.Exec(
-		"INSERT INTO cotizaciones (moneda, cotizacion, purchase, datetime, exchange) VALUES (?, ?, ?, ?, ?)",
-		moneda, bid, purchase, datetime, exchange,
-	)
+func (d *DB) withTx(ctx context.Context, fn func(t *DB) error) error {
+	if d.tx != nil {
+		return fn(d)
+	}
+	tx, err := d.conn.BeginTx(ctx, nil)
 	if err != nil {
-		return fmt.Errorf("error inserting cotizacion: %w", err)
+		return fmt.Errorf("error starting transaction: %w", err)
 	}
+	defer tx.Rollback()
 
+	if err := fn(&DB{conn: d.conn, q: tx, tx: tx, skipUnchanged: d.skipUnchanged, archive: d.archive}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
 	return nil
 }
 
-// GetAllCotizaciones retrieves all records from the cotizaciones table
-func (d *DB) GetAllCotizaciones() ([]Cotizacion, error) {
-	rows, err := d.conn.Query(
-		"SELECT moneda, cotizacion, purchase, datetime, exchange, moneda_dest FROM cotizaciones ORDER BY datetime ASC",
+// upsertCotizacion inserts a row, or overwrites the prices of the row with the same
+// (moneda, exchange, datetime). With the skip flag (?9) nothing is written when the
+// latest row of the moneda/exchange has the same prices.
+const upsertCotizacion = `INSERT INTO cotizaciones (moneda, cotizacion, purchase, ask, total_bid, datetime, exchange, source_datetime)
+SELECT ?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8
+WHERE NOT ?9 OR NOT EXISTS (
+	SELECT 1 FROM (
+		SELECT cotizacion, purchase, ask, total_bid FROM cotizaciones
+		WHERE moneda = ?1 AND exchange = ?7 ORDER BY datetime DESC LIMIT 1
+	) p
+	WHERE p.cotizacion IS ?2 AND p.purchase IS ?3 AND p.ask IS ?4 AND p.total_bid IS ?5
+)
+ON CONFLICT (moneda, exchange, datetime) DO UPDATE SET
+	cotizacion = excluded.cotizacion,
+	purchase = excluded.purchase,
+	ask = excluded.ask,
+	total_bid = excluded.total_bid,
+	source_datetime = excluded.source_datetime`
+
+// InsertCotizacion stores a cotizacion stamped with the current (ingestion) time
+// in UTC; the source timestamp is kept in source_datetime. Rows are unique per
+// (moneda, exchange, datetime): a re-run within the same second overwrites the
+// prices instead of failing. It reports false when nothing was written because
+// Options.SkipUnchanged is set and the prices equal the previous row.
+func (d *DB) InsertCotizacion(ctx context.Context, c Cotizacion) (bool, error) {
+	datetime := FormatTime(time.Now())
+
+	var sourceDT any
+	if c.SourceDatetime != "" {
+		sourceDT = c.SourceDatetime
+	}
+
+	res, err := d.q.ExecContext(ctx, upsertCotizacion,
+		c.Moneda, c.Cotizacion, c.Purchase, nullIfZero(c.Ask), nullIfZero(c.TotalBid), datetime, c.Exchange, sourceDT,
+		d.skipUnchanged,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("error querying cotizaciones: %w", err)
+		return false, fmt.Errorf("error inserting cotizacion: %w", err)
 	}
-	defer rows.Close()
-
-	var cotizaciones []Cotizacion
-	for rows.Next() {
-		var c Cotizacion
-		if err := rows.Scan(&c.Moneda, &c.Cotizacion, &c.Purchase, &c.Datetime, &c.Exchange, &c.MonedaDest); err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
-		}
-		cotizaciones = append(cotizaciones, c)
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("error inserting cotizacion: %w", err)
 	}
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating rows: %w", err)
+
+	return n > 0, nil
+}
+
+// nullIfZero maps an unknown (zero) price to NULL.
+func nullIfZero(v float64) any {
+	if v == 0 {
+		return nil
 	}
+	return v
+}
 
-	return cotizaciones, nil
+// GetAllCotizaciones retrieves all records from the cotizaciones table
+func (d *DB) GetAllCotizaciones(ctx context.Context) ([]Cotizacion, error) {
+	return d.queryCotizaciones(ctx, "SELECT "+cotizacionCols+" FROM cotizaciones ORDER BY datetime ASC")
 }
 
 // ExportCotizacionesToJSON exports all cotizaciones to a JSON file
-func (d *DB) ExportCotizacionesToJSON(outputPath string) error {
-	cotizaciones, err := d.GetAllCotizaciones()
+func (d *DB) ExportCotizacionesToJSON(ctx context.Context, outputPath string) error {
+	cotizaciones, err := d.GetAllCotizaciones(ctx)
 	if err != nil {
 		return err
 	}
+	return writeJSON(outputPath, cotizaciones)
+}
+
+// writeJSON writes cotizaciones as the indented JSON array read by the frontend.
+// Datetimes are written in La Paz time, as the frontend has always received them.
+func writeJSON(outputPath string, cotizaciones []Cotizacion) error {
+	local := make([]Cotizacion, len(cotizaciones))
+	for i, c := range cotizaciones {
+		c.Datetime = toLocal(c.Datetime)
+		c.SourceDatetime = toLocal(c.SourceDatetime)
+		local[i] = c
+	}
 
-	data, err := json.MarshalIndent(cotizaciones, "", "  ")
+	data, err := json.MarshalIndent(local, "", "  ")
 	if err != nil {
 		return fmt.Errorf("error marshaling JSON: %w", err)
 	}
@@ -144,9 +312,9 @@ func (d *DB) ExportCotizacionesToJSON(outputPath string) error {
 }
 
 // GetConfig retrieves the single config record
-func (d *DB) GetConfig() (*Config, error) {
+func (d *DB) GetConfig(ctx context.Context) (*Config, error) {
 	var cfg Config
-	err := d.conn.QueryRow("SELECT currentdate, chatid, messageid, umbral, umbral_referencial FROM config LIMIT 1").
+	err := d.q.QueryRowContext(ctx, "SELECT currentdate, chatid, messageid, umbral, umbral_referencial FROM config LIMIT 1").
 		Scan(&cfg.CurrentDate, &cfg.ChatID, &cfg.MessageID, &cfg.Umbral, &cfg.UmbralReferencial)
 	if err != nil {
 		return nil, fmt.Errorf("error reading config: %w", err)
@@ -155,12 +323,12 @@ func (d *DB) GetConfig() (*Config, error) {
 }
 
 // UpdateConfig updates currentdate, messageid, umbral (USDT) y umbral_referencial (USD Ref)
-func (d *DB) UpdateConfig(currentDate, messageID string, umbralUSDT, umbralRef float64) error {
+func (d *DB) UpdateConfig(ctx context.Context, currentDate, messageID string, umbralUSDT, umbralRef float64) error {
 	var mID any = messageID
 	if messageID == "" {
 		mID = nil
 	}
-	res, err := d.conn.Exec(
+	res, err := d.q.ExecContext(ctx,
 		"UPDATE config SET currentdate = ?, messageid = ?, umbral = ?, umbral_referencial = ? WHERE rowid = (SELECT rowid FROM config LIMIT 1)",
 		currentDate, mID, umbralUSDT, umbralRef,
 	)
@@ -175,12 +343,12 @@ func (d *DB) UpdateConfig(currentDate, messageID string, umbralUSDT, umbralRef f
 }
 
 // UpdateConfigMessageID updates only the currentdate and messageid while preserving metrics thresholds.
-func (d *DB) UpdateConfigMessageID(currentDate, messageID string) error {
+func (d *DB) UpdateConfigMessageID(ctx context.Context, currentDate, messageID string) error {
 	var mID any = messageID
 	if messageID == "" {
 		mID = nil
 	}
-	res, err := d.conn.Exec(
+	res, err := d.q.ExecContext(ctx,
 		"UPDATE config SET currentdate = ?, messageid = ? WHERE rowid = (SELECT rowid FROM config LIMIT 1)",
 		currentDate, mID,
 	)
@@ -194,43 +362,68 @@ func (d *DB) UpdateConfigMessageID(currentDate, messageID string) error {
 	return nil
 }
 
-// DeleteOlderThan deletes cotizaciones older than the given duration and returns the count deleted.
-func (d *DB) DeleteOlderThan(d1 time.Duration) (int64, error) {
-	cutoff := time.Now().Add(-d1).Format(timeFmt)
-	result, err := d.conn.Exec("DELETE FROM cotizaciones WHERE datetime < ?", cutoff)
-	if err != nil {
-		return 0, fmt.Errorf("error deleting old cotizaciones: %w", err)
-	}
-	return result.RowsAffected()
+// DeleteOlderThan deletes cotizaciones older than the given duration (archiving
+// them first, see SetArchiver) and returns the count deleted.
+func (d *DB) DeleteOlderThan(ctx context.Context, d1 time.Duration) (int64, error) {
+	cutoff := FormatTime(time.Now().Add(-d1))
+	var n int64
+	err := d.withTx(ctx, func(t *DB) error {
+		var err error
+		n, err = t.deleteCotizaciones(ctx, "datetime < ?", cutoff)
+		return err
+	})
+	return n, err
 }
 
 // GetLatestByMoneda returns the most recent cotizacion for a specific moneda
-func (d *DB) GetLatestByMoneda(name string) (Cotizacion, error) {
-	var c Cotizacion
-	var md sql.NullString
-	err := d.conn.QueryRow(
-		"SELECT moneda, cotizacion, purchase, datetime, exchange, moneda_dest FROM cotizaciones WHERE moneda = ? ORDER BY datetime DESC LIMIT 1",
+func (d *DB) GetLatestByMoneda(ctx context.Context, name string) (Cotizacion, error) {
+	return scanCotizacion(d.q.QueryRowContext(ctx,
+		"SELECT "+cotizacionCols+" FROM cotizaciones WHERE moneda = ? ORDER BY datetime DESC LIMIT 1",
 		name,
-	).Scan(&c.Moneda, &c.Cotizacion, &c.Purchase, &c.Datetime, &c.Exchange, &md)
+	))
+}
 
-	if err != nil {
-		return Cotizacion{}, err
-	}
-	c.MonedaDest = md.String
-	return c, nil
+// GetLatestByExchange returns the most recent cotizacion for a moneda on a specific exchange
+func (d *DB) GetLatestByExchange(ctx context.Context, name, exchange string) (Cotizacion, error) {
+	return scanCotizacion(d.q.QueryRowContext(ctx,
+		"SELECT "+cotizacionCols+" FROM cotizaciones WHERE moneda = ? AND exchange = ? ORDER BY datetime DESC LIMIT 1",
+		name, exchange,
+	))
+}
+
+// GetLatestPerExchange returns the most recent cotizacion of a moneda on every exchange,
+// ordered by exchange name. Used to compare venues.
+func (d *DB) GetLatestPerExchange(ctx context.Context, name string) ([]Cotizacion, error) {
+	return d.queryCotizaciones(ctx,
+		"SELECT "+cotizacionCols+` FROM cotizaciones c
+		 WHERE moneda = ? AND datetime = (
+		   SELECT MAX(datetime) FROM cotizaciones WHERE moneda = c.moneda AND exchange = c.exchange)
+		 ORDER BY exchange`,
+		name,
+	)
+}
+
+// GetLatestSummary returns a map of the latest quotes of every registered instrument
+func (d *DB) GetLatestSummary(ctx context.Context) (map[string]Cotizacion, error) {
+	return latestSummary(ctx, d)
 }
 
-// GetLatestSummary returns a map of the latest quotes for the three main types
-func (d *DB) GetLatestSummary() (map[string]Cotizacion, error) {
+// latestSummary builds the summary of every registered instrument from s.
+func latestSummary(ctx context.Context, s Store) (map[string]Cotizacion, error) {
 	summary := make(map[string]Cotizacion)
 
-	monedas := []string{"USDT", "usd oficial", "usd referencial", "eur", "oro", "plata", "ufv"}
-	for _, m := range monedas {
-		c, err := d.GetLatestByMoneda(m)
+	for _, inst := range instrument.All {
+		var c Cotizacion
+		var err error
+		if inst.Exchange != "" {
+			c, err = s.GetLatestByExchange(ctx, inst.Key, inst.Exchange)
+		} else {
+			c, err = s.GetLatestByMoneda(ctx, inst.Key)
+		}
 		if err == nil {
-			summary[m] = c
-		} else if err != sql.ErrNoRows {
-			return nil, fmt.Errorf("error fetching %s: %w", m, err)
+			summary[inst.Key] = c
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("error fetching %s: %w", inst.Key, err)
 		}
 	}
 
@@ -0,0 +1,44 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// Store is the persistence used by the pipeline and the Telegram step. *DB
+// implements it on SQLite; MemStore is an in-memory fake for tests.
+type Store interface {
+	// cotizaciones
+	InsertCotizacion(ctx context.Context, c Cotizacion) (bool, error)
+	InsertQuarantine(ctx context.Context, moneda, exchange string, bid, purchase float64, reason string) error
+	GetLatestByMoneda(ctx context.Context, name string) (Cotizacion, error)
+	GetLatestByExchange(ctx context.Context, name, exchange string) (Cotizacion, error)
+	GetLatestSummary(ctx context.Context) (map[string]Cotizacion, error)
+	GetRange(ctx context.Context, moneda string, from, to time.Time) ([]Cotizacion, error)
+	GetValueAt(ctx context.Context, moneda, exchange string, t time.Time) (float64, error)
+	GetAllCotizaciones(ctx context.Context) ([]Cotizacion, error)
+	ExportCotizacionesToJSON(ctx context.Context, outputPath string) error
+
+	// suscriptores
+	GetSubscribers(ctx context.Context) ([]Subscriber, error)
+	AddSubscriber(ctx context.Context, s Subscriber) (int64, error)
+	UpdateSubscriber(ctx context.Context, id int64, currentDate, messageID string, umbralUSDT, umbralRef float64) error
+	UpdateSubscriberMessageID(ctx context.Context, id int64, currentDate, messageID string) error
+
+	// outbox y auditoría
+	EnqueueOutbox(ctx context.Context, m OutboxMessage) (int64, error)
+	GetPendingOutbox(ctx context.Context) ([]OutboxMessage, error)
+	CompleteOutbox(ctx context.Context, id int64, status OutboxStatus, sentMessageID int, errMsg string) error
+	ExpireOutbox(ctx context.Context, before time.Time) (int64, error)
+	InsertNotification(ctx context.Context, n Notification) error
+
+	// WithTx runs fn as a unit of work over the Store passed to it.
+	WithTx(ctx context.Context, fn func(tx Store) error) error
+
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*MemStore)(nil)
+)
@@ -0,0 +1,116 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// Subscriber represents a row in the subscribers table: a Telegram chat or
+// channel with its own live message and thresholds.
+type Subscriber struct {
+	ID                int64
+	ChatID            string
+	Name              string
+	CurrentDate       sql.NullString
+	MessageID         sql.NullString
+	Umbral            sql.NullFloat64 // referencia USDT
+	UmbralReferencial sql.NullFloat64 // referencia USD Referencial
+	SpikeThreshold    float64         // variación que dispara un spike
+	Instruments       []string        // claves de instrument; vacío = todas
+	Silent            bool            // también los spikes se envían sin sonido
+	Enabled           bool
+}
+
+const subscriberCols = "id, chatid, name, currentdate, messageid, umbral, umbral_referencial, spike_threshold, instruments, silent, enabled"
+
+// GetSubscribers returns the enabled subscribers ordered by id.
+func (d *DB) GetSubscribers(ctx context.Context) ([]Subscriber, error) {
+	rows, err := d.q.QueryContext(ctx, "SELECT "+subscriberCols+" FROM subscribers WHERE enabled = 1 ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("error querying subscribers: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Subscriber
+	for rows.Next() {
+		var s Subscriber
+		var instruments string
+		if err := rows.Scan(&s.ID, &s.ChatID, &s.Name, &s.CurrentDate, &s.MessageID, &s.Umbral, &s.UmbralReferencial,
+			&s.SpikeThreshold, &instruments, &s.Silent, &s.Enabled); err != nil {
+			return nil, fmt.Errorf("error scanning subscriber: %w", err)
+		}
+		s.Instruments = splitKeys(instruments)
+		out = append(out, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows: %w", err)
+	}
+	return out, nil
+}
+
+// AddSubscriber inserts a subscriber and returns its id. Thresholds and message
+// ID start empty and are filled on the first run.
+func (d *DB) AddSubscriber(ctx context.Context, s Subscriber) (int64, error) {
+	if s.ChatID == "" {
+		return 0, fmt.Errorf("subscriber chat ID vacío")
+	}
+	if s.SpikeThreshold <= 0 {
+		s.SpikeThreshold = 0.20
+	}
+	res, err := d.q.ExecContext(ctx,
+		"INSERT INTO subscribers (chatid, name, spike_threshold, instruments, silent, enabled) VALUES (?, ?, ?, ?, ?, ?)",
+		s.ChatID, s.Name, s.SpikeThreshold, strings.Join(s.Instruments, ","), s.Silent, s.Enabled,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error inserting subscriber: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// UpdateSubscriber updates currentdate, messageid and both thresholds of a subscriber.
+func (d *DB) UpdateSubscriber(ctx context.Context, id int64, currentDate, messageID string, umbralUSDT, umbralRef float64) error {
+	return d.updateSubscriber(ctx, id,
+		"UPDATE subscribers SET currentdate = ?, messageid = ?, umbral = ?, umbral_referencial = ? WHERE id = ?",
+		currentDate, nullIfEmpty(messageID), umbralUSDT, umbralRef, id,
+	)
+}
+
+// UpdateSubscriberMessageID updates only currentdate and messageid, preserving the thresholds.
+func (d *DB) UpdateSubscriberMessageID(ctx context.Context, id int64, currentDate, messageID string) error {
+	return d.updateSubscriber(ctx, id,
+		"UPDATE subscribers SET currentdate = ?, messageid = ? WHERE id = ?",
+		currentDate, nullIfEmpty(messageID), id,
+	)
+}
+
+func (d *DB) updateSubscriber(ctx context.Context, id int64, query string, args ...any) error {
+	res, err := d.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("error updating subscriber %d: %w", id, err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("subscriber %d no existe", id)
+	}
+	return nil
+}
+
+// nullIfEmpty stores empty strings as NULL.
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// splitKeys parses a comma separated list, ignoring blanks.
+func splitKeys(s string) []string {
+	var out []string
+	for _, k := range strings.Split(s, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			out = append(out, k)
+		}
+	}
+	return out
+}
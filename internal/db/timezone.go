@@ -0,0 +1,80 @@
+package db
+
+import (
+	"fmt"
+	"time"
+	_ "time/tzdata" // America/La_Paz también en contenedores sin zoneinfo
+)
+
+// Location is the zone every timestamp is displayed in. Stored timestamps are
+// UTC in timeFmt, so the result does not depend on the container's clock zone.
+var Location = mustLoadLocation("America/La_Paz")
+
+// localModifier shifts a stored UTC datetime to Location in SQLite date
+// functions. Bolivia has no daylight saving time, so a fixed offset is exact.
+var localModifier = func() string {
+	_, offset := time.Now().In(Location).Zone()
+	return fmt.Sprintf("%+d seconds", offset)
+}()
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(fmt.Sprintf("error loading time zone %s: %v", name, err))
+	}
+	return loc
+}
+
+// FormatTime returns t in the storage format (UTC).
+func FormatTime(t time.Time) string {
+	return t.UTC().Format(timeFmt)
+}
+
+// ParseTime parses a stored datetime (UTC).
+func ParseTime(s string) (time.Time, error) {
+	return time.ParseInLocation(timeFmt, s, time.UTC)
+}
+
+// ParseStoredTime parses a datetime as found in the table: the storage format
+// or the older minute precision, both UTC, or a date only, which is a day of La
+// Paz and is returned at its start with dateOnly set.
+func ParseStoredTime(s string) (t time.Time, dateOnly bool, err error) {
+	for _, layout := range []string{timeFmt, "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t, false, nil
+		}
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, Location); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, fmt.Errorf("datetime inválido %q", s)
+}
+
+// Today returns the current date in Location, e.g. "2025-01-31".
+func Today() string {
+	return time.Now().In(Location).Format("2006-01-02")
+}
+
+// toLocal converts a stored datetime to Location keeping the storage format;
+// other values (date-only, empty) are returned unchanged.
+func toLocal(dt string) string {
+	t, dateOnly, err := ParseStoredTime(dt)
+	if err != nil || dateOnly {
+		return dt
+	}
+	return t.In(Location).Format(timeFmt)
+}
+
+// Display converts a stored datetime to Location for display. Values with time
+// show seconds; date-only values (e.g. BCB publication dates) show only the date.
+func Display(dt string) string {
+	t, dateOnly, err := ParseStoredTime(dt)
+	switch {
+	case err != nil:
+		return dt
+	case dateOnly:
+		return t.Format(DisplayDateFmt)
+	default:
+		return t.In(Location).Format(DisplayTimeFmt)
+	}
+}
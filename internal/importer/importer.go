@@ -0,0 +1,383 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cotizaciones/internal/db"
+)
+
+// Formats accepted by Read.
+const (
+	FormatCSV  = "csv"
+	FormatJSON = "json"
+)
+
+// naiveLayouts are accepted datetimes without zone, read as La Paz time (the
+// export and the spreadsheets use local time). Date-only values mean midnight.
+var naiveLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"2006-01-02",
+	"02/01/2006",
+}
+
+// Defaults fill columns missing from a CSV file.
+type Defaults struct {
+	Moneda   string
+	Exchange string
+	Decimal  string // decimal separator of the CSV numbers, "." or ","; empty infers it per file
+}
+
+// RowError is a row rejected by validation.
+type RowError struct {
+	Row int // 1-based: CSV line (header is line 1) or JSON array position
+	Err error
+}
+
+func (e RowError) Error() string {
+	return fmt.Sprintf("fila %d: %v", e.Row, e.Err)
+}
+
+// row is a parsed record and its position in the input.
+type row struct {
+	n int
+	c db.Cotizacion
+}
+
+// Read parses r in the given format and returns the valid rows, normalized for
+// storage (datetimes in UTC), plus the rows rejected by validation.
+func Read(r io.Reader, format string, def Defaults) ([]db.Cotizacion, []RowError, error) {
+	var rows []row
+	var rowErrs []RowError
+	switch format {
+	case FormatJSON:
+		// la forma exacta de ExportCotizacionesToJSON
+		var raw []db.Cotizacion
+		if err := json.NewDecoder(r).Decode(&raw); err != nil {
+			return nil, nil, fmt.Errorf("error decoding JSON: %w", err)
+		}
+		for i, c := range raw {
+			rows = append(rows, row{n: i + 1, c: c})
+		}
+	case FormatCSV:
+		if def.Decimal != "" && def.Decimal != "." && def.Decimal != "," {
+			return nil, nil, fmt.Errorf("separador decimal inválido %q (. o ,)", def.Decimal)
+		}
+		var err error
+		rows, rowErrs, err = readCSV(r, def)
+		if err != nil {
+			return nil, nil, err
+		}
+	default:
+		return nil, nil, fmt.Errorf("formato desconocido %q (csv o json)", format)
+	}
+
+	out := make([]db.Cotizacion, 0, len(rows))
+	for _, r := range rows {
+		c, err := Normalize(r.c)
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Row: r.n, Err: err})
+			continue
+		}
+		out = append(out, c)
+	}
+	sort.Slice(rowErrs, func(i, j int) bool { return rowErrs[i].Row < rowErrs[j].Row })
+	return out, rowErrs, nil
+}
+
+// Normalize validates c and converts its datetimes to the storage format.
+func Normalize(c db.Cotizacion) (db.Cotizacion, error) {
+	c.Moneda = strings.TrimSpace(c.Moneda)
+	c.Exchange = strings.TrimSpace(c.Exchange)
+	if c.Moneda == "" {
+		return c, fmt.Errorf("moneda vacía")
+	}
+	if c.Cotizacion <= 0 {
+		return c, fmt.Errorf("cotizacion inválida %v", c.Cotizacion)
+	}
+	if c.Purchase < 0 || c.Ask < 0 || c.TotalBid < 0 {
+		return c, fmt.Errorf("precio negativo")
+	}
+
+	t, _, err := ParseTime(c.Datetime)
+	if err != nil {
+		return c, err
+	}
+	c.Datetime = db.FormatTime(t)
+
+	if c.SourceDatetime != "" {
+		st, dateOnly, err := ParseTime(c.SourceDatetime)
+		if err != nil {
+			return c, fmt.Errorf("source_datetime: %w", err)
+		}
+		if dateOnly {
+			c.SourceDatetime = st.Format("2006-01-02") // fecha de publicación, como el BCB
+		} else {
+			c.SourceDatetime = db.FormatTime(st)
+		}
+	}
+	return c, nil
+}
+
+// ParseTime parses an imported datetime: RFC3339 with offset, or one of
+// naiveLayouts in La Paz time. dateOnly reports a value without time of day.
+func ParseTime(s string) (t time.Time, dateOnly bool, err error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false, fmt.Errorf("datetime vacío")
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range naiveLayouts {
+		if t, err := time.ParseInLocation(layout, s, db.Location); err == nil {
+			return t, !strings.Contains(layout, "15"), nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("datetime inválido %q", s)
+}
+
+// readCSV reads a CSV with a header naming the columns like the JSON export
+// (moneda, cotizacion, purchase, ask, total_bid, datetime, exchange,
+// moneda_dest, source_datetime). The delimiter (',' or ';') is detected from
+// the header and the decimal separator, unless def.Decimal sets it, from the
+// numbers that can only be read one way (see inferDecimal). Rows with
+// unreadable numbers are returned as RowError.
+func readCSV(r io.Reader, def Defaults) ([]row, []RowError, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(4096)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, nil, fmt.Errorf("error reading CSV: %w", err)
+	}
+	line, _, _ := strings.Cut(string(header), "\n")
+
+	cr := csv.NewReader(br)
+	if strings.Count(line, ";") > strings.Count(line, ",") {
+		cr.Comma = ';'
+	}
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+
+	names, err := cr.Read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error reading CSV header: %w", err)
+	}
+	cols := make(map[string]int, len(names))
+	for i, n := range names {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(n, "\ufeff")))] = i
+	}
+	if _, ok := cols["cotizacion"]; !ok {
+		return nil, nil, fmt.Errorf("CSV sin columna cotizacion")
+	}
+	if _, ok := cols["datetime"]; !ok {
+		return nil, nil, fmt.Errorf("CSV sin columna datetime")
+	}
+	if _, ok := cols["moneda"]; !ok && def.Moneda == "" {
+		return nil, nil, fmt.Errorf("CSV sin columna moneda (use -moneda)")
+	}
+
+	var recs [][]string
+	for line := 2; ; line++ {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("error reading CSV line %d: %w", line, err)
+		}
+		recs = append(recs, rec)
+	}
+
+	numCols := []string{"cotizacion", "purchase", "ask", "total_bid"}
+	var dec byte
+	if def.Decimal != "" {
+		dec = def.Decimal[0]
+	} else {
+		var values []string
+		for _, rec := range recs {
+			for _, name := range numCols {
+				if i, ok := cols[name]; ok && i < len(rec) {
+					values = append(values, strings.TrimSpace(rec[i]))
+				}
+			}
+		}
+		dec = inferDecimal(values)
+	}
+
+	var out []row
+	var rowErrs []RowError
+	for n, rec := range recs {
+		line := n + 2
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+
+		c := db.Cotizacion{
+			Moneda:         get("moneda"),
+			Datetime:       get("datetime"),
+			Exchange:       get("exchange"),
+			MonedaDest:     get("moneda_dest"),
+			SourceDatetime: get("source_datetime"),
+		}
+		if c.Moneda == "" {
+			c.Moneda = def.Moneda
+		}
+		if c.Exchange == "" {
+			c.Exchange = def.Exchange
+		}
+		var numErr error
+		for i, dst := range []*float64{&c.Cotizacion, &c.Purchase, &c.Ask, &c.TotalBid} {
+			var err error
+			if *dst, err = parseNumber(get(numCols[i]), dec); err != nil && numErr == nil {
+				numErr = fmt.Errorf("%s: %w", numCols[i], err)
+			}
+		}
+		if numErr != nil {
+			rowErrs = append(rowErrs, RowError{Row: line, Err: numErr})
+			continue
+		}
+		out = append(out, row{n: line, c: c})
+	}
+	return out, rowErrs, nil
+}
+
+// inferDecimal returns the decimal separator used by values, judging only the
+// numbers that can be read one way: both separators ("1.234,56"), a repeated one
+// ("1.234.567") or a fraction that is not three digits long ("6,96"). It
+// returns 0 when none decides or the values disagree.
+func inferDecimal(values []string) byte {
+	var seen [2]bool // '.', ','
+	for _, s := range values {
+		switch decimalHint(s) {
+		case '.':
+			seen[0] = true
+		case ',':
+			seen[1] = true
+		}
+	}
+	switch {
+	case seen[0] && !seen[1]:
+		return '.'
+	case seen[1] && !seen[0]:
+		return ','
+	}
+	return 0
+}
+
+// decimalHint returns the decimal separator s can only have been written with,
+// or 0 if s has none or could be read either way.
+func decimalHint(s string) byte {
+	digits := strings.TrimLeft(s, "+-")
+	dot, comma := strings.LastIndexByte(digits, '.'), strings.LastIndexByte(digits, ',')
+	switch {
+	case dot >= 0 && comma >= 0:
+		if comma > dot {
+			return ','
+		}
+		return '.'
+	case dot < 0 && comma < 0:
+		return 0
+	}
+	sep, other := byte('.'), byte(',')
+	if comma >= 0 {
+		sep, other = ',', '.'
+	}
+	parts := strings.Split(digits, string(sep))
+	switch {
+	case len(parts) > 2:
+		return other
+	case len(parts[1]) != 3 || len(parts[0]) > 3 || parts[0] == "0" || parts[0] == "":
+		return sep
+	}
+	return 0
+}
+
+// parseNumber parses a spreadsheet number in either convention: "6.96", "6,96",
+// "1.234,56" or "1,234.56". dec is the decimal separator of the file ('.' or
+// ','), 0 if unknown. When both '.' and ',' appear the last one is the decimal
+// separator. A single separator is read as dec when it is known; otherwise a
+// separator followed by exactly three digits is decimal after one or two digits
+// ("6.960", the usual precision of the rates) and rejected as ambiguous after
+// three ("123,456"). Empty is 0.
+func parseNumber(s string, dec byte) (float64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	digits := strings.TrimLeft(s, "+-")
+	fileDec := dec
+	var group byte
+	switch dot, comma := strings.LastIndexByte(digits, '.'), strings.LastIndexByte(digits, ','); {
+	case dot >= 0 && comma >= 0:
+		dec, group = '.', ','
+		if comma > dot {
+			dec, group = ',', '.'
+		}
+		if fileDec != 0 && fileDec != dec {
+			return 0, fmt.Errorf("número %q no usa el separador decimal %q del archivo", s, fileDec)
+		}
+	case dot >= 0 || comma >= 0:
+		sep := byte('.')
+		if comma >= 0 {
+			sep = ','
+		}
+		parts := strings.Split(digits, string(sep))
+		switch {
+		case len(parts) > 2:
+			if fileDec == sep {
+				return 0, fmt.Errorf("número inválido %q (separador decimal repetido)", s)
+			}
+			dec, group = 0, sep // "1.234.567"
+		case fileDec != 0:
+			if sep != fileDec {
+				dec, group = 0, sep // "6.960" en un archivo con coma decimal
+			}
+		case len(parts[1]) == 3 && len(parts[0]) == 3:
+			return 0, fmt.Errorf("número ambiguo %q (¿separador de miles o decimal? use -decimal)", s)
+		default:
+			dec = sep
+		}
+	default:
+		dec = 0
+	}
+
+	if group != 0 {
+		parts := strings.Split(digits, string(group))
+		if dec != 0 {
+			last := parts[len(parts)-1]
+			parts[len(parts)-1] = last[:strings.IndexByte(last, dec)]
+		}
+		for i, p := range parts {
+			if (i == 0 && (len(p) == 0 || len(p) > 3)) || (i > 0 && len(p) != 3) {
+				return 0, fmt.Errorf("número inválido %q (separador de miles mal ubicado)", s)
+			}
+		}
+	}
+
+	norm := s
+	if group != 0 {
+		norm = strings.ReplaceAll(norm, string(group), "")
+	}
+	if dec == ',' {
+		norm = strings.Replace(norm, ",", ".", 1)
+	}
+	v, err := strconv.ParseFloat(norm, 64)
+	if err != nil {
+		return 0, fmt.Errorf("número inválido %q", s)
+	}
+	return v, nil
+}
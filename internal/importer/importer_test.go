@@ -0,0 +1,147 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseNumber(t *testing.T) {
+	tests := []struct {
+		in      string
+		dec     byte
+		want    float64
+		wantErr bool
+	}{
+		{in: "", want: 0},
+		{in: "7", want: 7},
+		{in: "6.96", want: 6.96},
+		{in: "6,96", want: 6.96},
+		{in: "-0,5", want: -0.5},
+		{in: "1.234,56", want: 1234.56},
+		{in: "1,234.56", want: 1234.56},
+		{in: "1.234.567", want: 1234567},
+		{in: "2936,45", want: 2936.45},
+		// tres decimales tras uno o dos dígitos: la precisión habitual de las tasas
+		{in: "6.960", want: 6.96},
+		{in: "6,965", want: 6.965},
+		{in: "7.125", want: 7.125},
+		{in: "12,345", want: 12.345},
+		{in: "1234,567", want: 1234.567},
+		{in: "123,456", wantErr: true},
+		{in: "123.456", wantErr: true},
+		// con el separador del archivo conocido
+		{in: "123,456", dec: ',', want: 123.456},
+		{in: "123.456", dec: ',', want: 123456},
+		{in: "6.960", dec: ',', want: 6960},
+		{in: "6.960", dec: '.', want: 6.96},
+		{in: "1.234,56", dec: '.', wantErr: true},
+		{in: "1.234.567", dec: '.', wantErr: true},
+		{in: "12.34", dec: ',', wantErr: true},
+		{in: "1,23,456.7", wantErr: true},
+		{in: "seis", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseNumber(tt.in, tt.dec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseNumber(%q, %q) = %v, want error", tt.in, tt.dec, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseNumber(%q, %q) = %v, %v; want %v", tt.in, tt.dec, got, err, tt.want)
+		}
+	}
+}
+
+func TestInferDecimal(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   byte
+	}{
+		{[]string{"6,960", "6,96", ""}, ','},
+		{[]string{"6.960", "1,234.50"}, '.'},
+		{[]string{"1.234.567", "6.960"}, ','},
+		{[]string{"6.960", "7.125", "7"}, 0},
+		{[]string{"6,96", "6.96"}, 0},
+	}
+	for _, tt := range tests {
+		if got := inferDecimal(tt.values); got != tt.want {
+			t.Errorf("inferDecimal(%q) = %q, want %q", tt.values, got, tt.want)
+		}
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		csv     string
+		dec     string
+		want    []float64 // cotizacion de cada fila válida
+		errRows []int
+	}{
+		{
+			name: "rates with three decimals",
+			csv:  "moneda,datetime,cotizacion,purchase\nUSDT,2025-03-14 10:00,6.960,7.125\nUSDT,2025-03-14 11:00,6.965,7.130\n",
+			want: []float64{6.96, 6.965},
+		},
+		{
+			name: "comma decimals inferred from the other rows",
+			csv:  "moneda;datetime;cotizacion\nBTC;2025-03-14 10:00;712.345,50\nBTC;2025-03-14 11:00;123,456\n",
+			want: []float64{712345.5, 123.456},
+		},
+		{
+			name:    "ambiguous without a hint",
+			csv:     "moneda,datetime,cotizacion\nBTC,2025-03-14 10:00,123.456\nBTC,2025-03-14 11:00,6.960\n",
+			want:    []float64{6.96},
+			errRows: []int{2},
+		},
+		{
+			name: "separator given with -decimal",
+			csv:  "moneda,datetime,cotizacion\nBTC,2025-03-14 10:00,123.456\n",
+			dec:  ".",
+			want: []float64{123.456},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, rowErrs, err := Read(strings.NewReader(tt.csv), FormatCSV, Defaults{Decimal: tt.dec})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows (%v), want %d", len(rows), rowErrs, len(tt.want))
+			}
+			for i, w := range tt.want {
+				if rows[i].Cotizacion != w {
+					t.Errorf("row %d: cotizacion %v, want %v", i, rows[i].Cotizacion, w)
+				}
+			}
+			if len(rowErrs) != len(tt.errRows) {
+				t.Fatalf("got errors %v, want rows %v", rowErrs, tt.errRows)
+			}
+			for i, n := range tt.errRows {
+				if rowErrs[i].Row != n {
+					t.Errorf("error %d on row %d, want %d", i, rowErrs[i].Row, n)
+				}
+			}
+		})
+	}
+}
+
+func TestReadNormalizesDatetimes(t *testing.T) {
+	rows, rowErrs, err := Read(strings.NewReader(
+		"moneda,datetime,cotizacion,source_datetime\nusd oficial,14/03/2025 08:00,6.96,14/03/2025\n"), FormatCSV, Defaults{})
+	if err != nil || len(rowErrs) != 0 || len(rows) != 1 {
+		t.Fatalf("got %v, %v, %v", rows, rowErrs, err)
+	}
+	if c := rows[0]; c.Datetime != "2025-03-14 12:00:00" || c.SourceDatetime != "2025-03-14" {
+		t.Errorf("got %q / %q, want UTC datetime and the publication date", c.Datetime, c.SourceDatetime)
+	}
+}
+
+func TestReadRejectsBadDecimalOption(t *testing.T) {
+	if _, _, err := Read(strings.NewReader("moneda,datetime,cotizacion\n"), FormatCSV, Defaults{Decimal: ";"}); err == nil {
+		t.Fatal("expected an error for an invalid decimal separator")
+	}
+}
@@ -0,0 +1,107 @@
+package instrument
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Keys of the instruments as stored in the moneda column.
+const (
+	USDT           = "USDT"
+	USDOficial     = "usd oficial"
+	USDReferencial = "usd referencial"
+	EUR            = "eur"
+	Oro            = "oro"
+	Plata          = "plata"
+	UFV            = "ufv"
+)
+
+// Instrument describes how a moneda is summarized and displayed.
+type Instrument struct {
+	Key        string // moneda in the cotizaciones table
+	Exchange   string // exchange used for the summary; empty means the latest of any exchange
+	Name       string // label in Telegram messages, e.g. "BCB - USD Oficial"
+	Title      string // heading in the price image, e.g. "USD OFICIAL – BCB"
+	Emoji      string
+	Precision  int    // decimals shown
+	Single     bool   // single value instead of a venta/compra pair
+	ValueLabel string // label of the single value, e.g. "Precio"
+	Source     string // publisher shown to users, e.g. "BCB"
+}
+
+// All is the registry every layer iterates, in display order: the built-in
+// instruments, then those of the configured pairs (see Register).
+var All = []Instrument{
+	{Key: USDT, Exchange: "binancep2p", Name: "USDT (Binance)", Title: "USDT – BINANCE P2P", Emoji: "💰", Precision: 4, Source: "Binance P2P"},
+	{Key: USDOficial, Name: "BCB - USD Oficial", Title: "USD OFICIAL – BCB", Emoji: "🏢", Precision: 2, Source: "BCB"},
+	{Key: USDReferencial, Name: "BCB - USD Referencial", Title: "USD REFERENCIAL – BCB", Emoji: "📊", Precision: 2, Source: "BCB"},
+	{Key: EUR, Name: "Euro", Title: "EURO – BCB", Emoji: "🇪🇺", Precision: 2, Source: "BCB"},
+	{Key: Oro, Name: "Oro (Troy Oz)", Title: "ORO (TROY OZ) – BCB", Emoji: "🥇", Precision: 2, Single: true, ValueLabel: "Precio", Source: "BCB"},
+	{Key: Plata, Name: "Plata (Troy Oz)", Title: "PLATA (TROY OZ) – BCB", Emoji: "🥈", Precision: 2, Single: true, ValueLabel: "Precio", Source: "BCB"},
+	{Key: UFV, Name: "UFV", Title: "UFV – BCB", Emoji: "📐", Precision: 5, Single: true, ValueLabel: "Valor", Source: "BCB"},
+}
+
+// Register adds the instruments of the configured pairs to All, after the
+// built-in ones. For a key already registered only Precision is taken, so the
+// pairs configuration is the single source of the decimals shown for a moneda;
+// a different non-empty Name is not applied and is reported in the returned
+// error, after registering everything else. It must be called before All is
+// read, at startup.
+func Register(insts ...Instrument) error {
+	var errs []error
+	for _, inst := range insts {
+		if i := slices.IndexFunc(All, func(o Instrument) bool { return o.Key == inst.Key }); i >= 0 {
+			All[i].Precision = inst.Precision
+			if inst.Name != "" && inst.Name != All[i].Name {
+				errs = append(errs, fmt.Errorf("%s: el nombre %q no se aplica, se muestra como %q", inst.Key, inst.Name, All[i].Name))
+			}
+			continue
+		}
+		All = append(All, inst)
+	}
+	return errors.Join(errs...)
+}
+
+// Get returns the registered instrument for key.
+func Get(key string) (Instrument, bool) {
+	for _, i := range All {
+		if i.Key == key {
+			return i, true
+		}
+	}
+	return Instrument{}, false
+}
+
+// Select returns the registered instruments whose key is in keys, in registry
+// order. An empty keys selects all of them; unknown keys are ignored.
+func Select(keys []string) []Instrument {
+	if len(keys) == 0 {
+		return All
+	}
+	var out []Instrument
+	for _, i := range All {
+		if slices.Contains(keys, i.Key) {
+			out = append(out, i)
+		}
+	}
+	return out
+}
+
+// Sources returns the distinct publishers of insts, in order of appearance.
+func Sources(insts []Instrument) []string {
+	var out []string
+	seen := make(map[string]bool)
+	for _, i := range insts {
+		if !seen[i.Source] {
+			seen[i.Source] = true
+			out = append(out, i.Source)
+		}
+	}
+	return out
+}
+
+// Format formats v with the instrument's precision.
+func (i Instrument) Format(v float64) string {
+	return fmt.Sprintf("%.*f", i.Precision, v)
+}
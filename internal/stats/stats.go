@@ -0,0 +1,199 @@
+package stats
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+)
+
+// Period is a horizon over which the change of a moneda is reported.
+type Period struct {
+	Name string
+	Span time.Duration
+}
+
+// Periods are the changes computed for every moneda, shortest first.
+var Periods = []Period{
+	{Name: "24h", Span: 24 * time.Hour},
+	{Name: "7d", Span: 7 * 24 * time.Hour},
+	{Name: "30d", Span: 30 * 24 * time.Hour},
+}
+
+// Change is the movement of the last value over a Period.
+type Change struct {
+	Period string  `json:"period"`
+	From   float64 `json:"from"` // value in effect at the start of the period
+	Abs    float64 `json:"abs"`
+	Pct    float64 `json:"pct"`
+}
+
+// Stats summarizes the recent history of one moneda on the exchange its
+// instrument is summarized from.
+type Stats struct {
+	Moneda   string   `json:"moneda"`
+	Exchange string   `json:"exchange"`
+	Last     float64  `json:"last"`
+	Datetime string   `json:"datetime"` // of Last (UTC in the DB, La Paz time in WriteJSON)
+	Changes  []Change `json:"changes"`  // only the periods with history
+
+	// Intraday (día de La Paz de Last)
+	High    float64 `json:"high"`
+	Low     float64 `json:"low"`
+	Avg     float64 `json:"avg"`
+	StdDev  float64 `json:"stddev"` // population standard deviation
+	Samples int     `json:"samples"`
+}
+
+// Set maps instrument keys to their Stats.
+type Set map[string]Stats
+
+// Source is what stats reads; db.Store implements it.
+type Source interface {
+	GetLatestByMoneda(ctx context.Context, name string) (db.Cotizacion, error)
+	GetLatestByExchange(ctx context.Context, name, exchange string) (db.Cotizacion, error)
+	GetRange(ctx context.Context, moneda string, from, to time.Time) ([]db.Cotizacion, error)
+	GetValueAt(ctx context.Context, moneda, exchange string, t time.Time) (float64, error)
+}
+
+// Compute returns the Stats of every instrument of insts with history. An
+// instrument whose stats fail is left out and its error is joined to the
+// returned one; the Set of the others is returned anyway.
+func Compute(ctx context.Context, src Source, insts []instrument.Instrument) (Set, error) {
+	set := make(Set, len(insts))
+	var errs []error
+	for _, inst := range insts {
+		s, ok, err := For(ctx, src, inst)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if ok {
+			set[inst.Key] = s
+		}
+	}
+	return set, errors.Join(errs...)
+}
+
+// For returns the Stats of inst; ok is false when there is no row for it.
+func For(ctx context.Context, src Source, inst instrument.Instrument) (Stats, bool, error) {
+	var last db.Cotizacion
+	var err error
+	if inst.Exchange != "" {
+		last, err = src.GetLatestByExchange(ctx, inst.Key, inst.Exchange)
+	} else {
+		last, err = src.GetLatestByMoneda(ctx, inst.Key)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return Stats{}, false, nil
+	}
+	if err != nil {
+		return Stats{}, false, fmt.Errorf("error fetching %s: %w", inst.Key, err)
+	}
+	at, _, err := db.ParseStoredTime(last.Datetime)
+	if err != nil {
+		return Stats{}, false, fmt.Errorf("error parsing datetime of %s: %w", inst.Key, err)
+	}
+
+	s := Stats{Moneda: last.Moneda, Exchange: last.Exchange, Last: last.Cotizacion, Datetime: last.Datetime, Changes: []Change{}}
+
+	for _, p := range Periods {
+		from, err := src.GetValueAt(ctx, last.Moneda, last.Exchange, at.Add(-p.Span))
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return Stats{}, false, fmt.Errorf("error fetching %s %s ago: %w", inst.Key, p.Name, err)
+		}
+		c := Change{Period: p.Name, From: from, Abs: s.Last - from}
+		if from != 0 {
+			c.Pct = c.Abs / from * 100
+		}
+		s.Changes = append(s.Changes, c)
+	}
+
+	local := at.In(db.Location)
+	dayStart := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, db.Location)
+	rows, err := src.GetRange(ctx, last.Moneda, dayStart, dayStart.AddDate(0, 0, 1))
+	if err != nil {
+		return Stats{}, false, err
+	}
+	var values []float64
+	for _, r := range rows {
+		if r.Exchange == last.Exchange {
+			values = append(values, r.Cotizacion)
+		}
+	}
+	s.High, s.Low, s.Avg, s.StdDev = describe(values)
+	s.Samples = len(values)
+
+	return s, true, nil
+}
+
+// describe returns max, min, mean and population standard deviation of values.
+func describe(values []float64) (high, low, avg, stddev float64) {
+	if len(values) == 0 {
+		return 0, 0, 0, 0
+	}
+	high, low = values[0], values[0]
+	var sum float64
+	for _, v := range values {
+		high, low = max(high, v), min(low, v)
+		sum += v
+	}
+	avg = sum / float64(len(values))
+	var sq float64
+	for _, v := range values {
+		sq += (v - avg) * (v - avg)
+	}
+	return high, low, avg, math.Sqrt(sq / float64(len(values)))
+}
+
+// Change returns the change of s over the named period, if there is history for it.
+func (s Stats) Change(period string) (Change, bool) {
+	for _, c := range s.Changes {
+		if c.Period == period {
+			return c, true
+		}
+	}
+	return Change{}, false
+}
+
+// WriteJSON writes set as an indented JSON document for the frontend, with the
+// instruments in registry order and datetimes in La Paz time like data.json.
+func WriteJSON(outputPath string, set Set) error {
+	doc := struct {
+		Generated string  `json:"generated"`
+		Stats     []Stats `json:"stats"`
+	}{Generated: time.Now().In(db.Location).Format(db.TimeFmt), Stats: []Stats{}}
+	for _, inst := range instrument.All {
+		s, ok := set[inst.Key]
+		if !ok {
+			continue
+		}
+		if t, dateOnly, err := db.ParseStoredTime(s.Datetime); err == nil && !dateOnly {
+			s.Datetime = t.In(db.Location).Format(db.TimeFmt)
+		}
+		doc.Stats = append(doc.Stats, s)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("error creating output directory: %w", err)
+	}
+	if err := os.WriteFile(outputPath, data, 0644); err != nil {
+		return fmt.Errorf("error writing JSON file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package stats
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+)
+
+func TestComputeSkipsUnparsableInstruments(t *testing.T) {
+	store := db.NewMemStore()
+	store.Cotizaciones = []db.Cotizacion{
+		{Moneda: instrument.USDT, Exchange: "binancep2p", Cotizacion: 6.90, Datetime: "2025-03-13 15:00:00"},
+		{Moneda: instrument.USDT, Exchange: "binancep2p", Cotizacion: 6.95, Datetime: "2025-03-14 14:00:00"},
+		{Moneda: instrument.USDT, Exchange: "binancep2p", Cotizacion: 7.00, Datetime: "2025-03-14 15:00:00"},
+		{Moneda: instrument.USDOficial, Exchange: "bcb", Cotizacion: 6.96, Datetime: "2025-03-14 16:05"}, // precisión de minutos
+		{Moneda: instrument.EUR, Exchange: "bcb", Cotizacion: 7.61, Datetime: "2025-03-14"},              // solo fecha
+		{Moneda: instrument.USDReferencial, Exchange: "bcb", Cotizacion: 7.18, Datetime: "ayer"},
+	}
+
+	set, err := Compute(context.Background(), store, instrument.All)
+	if err == nil || !strings.Contains(err.Error(), instrument.USDReferencial) {
+		t.Errorf("got error %v, want one about %s", err, instrument.USDReferencial)
+	}
+	for _, key := range []string{instrument.USDT, instrument.USDOficial, instrument.EUR} {
+		if _, ok := set[key]; !ok {
+			t.Errorf("%s missing from the set", key)
+		}
+	}
+	if _, ok := set[instrument.USDReferencial]; ok {
+		t.Errorf("%s should be left out", instrument.USDReferencial)
+	}
+
+	usdt := set[instrument.USDT]
+	if c, ok := usdt.Change("24h"); !ok || c.From != 6.90 || c.Abs < 0.0999 || c.Abs > 0.1001 {
+		t.Errorf("24h change %+v, want from 6.90 by +0.10", c)
+	}
+	if usdt.Samples != 2 || usdt.High != 7.00 || usdt.Low != 6.95 {
+		t.Errorf("intraday %d samples %v–%v, want 2 samples 6.95–7.00", usdt.Samples, usdt.Low, usdt.High)
+	}
+
+	path := filepath.Join(t.TempDir(), "stats.json")
+	if err := WriteJSON(path, set); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc struct{ Stats []Stats }
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]string)
+	for _, s := range doc.Stats {
+		got[s.Moneda] = s.Datetime
+	}
+	want := map[string]string{
+		instrument.USDT:       "2025-03-14 11:00:00",
+		instrument.USDOficial: "2025-03-14 12:05:00",
+		instrument.EUR:        "2025-03-14",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s datetime %q, want %q (La Paz)", k, got[k], v)
+		}
+	}
+}
@@ -2,38 +2,46 @@ package telegram
 
 import (
 	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
 	"fmt"
+	"html"
 	"math"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf16"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 const siteURL = "https://cotizaciones.devcito.org/"
 
-// fmtDT convierte un datetime de la DB al formato legible para Telegram.
-// Si el valor contiene hora, muestra segundos; si es solo fecha, muestra solo la fecha.
-func fmtDT(dt string) string {
-	layouts := []string{
-		db.TimeFmt,
-		"2006-01-02 15:04",
-		"2006-01-02",
-	}
+// maxCaptionLen is Telegram's limit for photo captions, in UTF-16 code units of
+// the text once the HTML is parsed. Messages are sent as captions of the price
+// image, so the formatters keep them within it.
+const maxCaptionLen = 1024
+
+var htmlTagRe = regexp.MustCompile(`<[^>]*>`)
+
+// captionLen returns the length of an HTML message as Telegram counts it.
+func captionLen(text string) int {
+	return len(utf16.Encode([]rune(html.UnescapeString(htmlTagRe.ReplaceAllString(text, "")))))
+}
 
-	for _, layout := range layouts {
-		t, err := time.Parse(layout, dt)
-		if err != nil {
-			continue
+// fitCaption joins head, body and foot, dropping trailing body lines until the
+// text fits in maxCaptionLen; a note tells how many were left out.
+func fitCaption(head, body, foot []string) string {
+	for n := len(body); ; n-- {
+		lines := append(append([]string{}, head...), body[:n]...)
+		if n < len(body) {
+			lines = append(lines, fmt.Sprintf("➕ <i>%d instrumentos más en la imagen y la web</i>", len(body)-n))
 		}
-		if layout == db.TimeFmt || layout == "2006-01-02 15:04" {
-			return t.Format(db.DisplayTimeFmt)
+		text := strings.Join(append(lines, foot...), "\n")
+		if n == 0 || captionLen(text) <= maxCaptionLen {
+			return text
 		}
-		return t.Format(db.DisplayDateFmt)
 	}
-
-	return dt
 }
 
 // fmtDest returns a formatted moneda destino tag, or empty if blank.
@@ -65,19 +73,49 @@ func New(token, chatID string) (*Bot, error) {
 	return &Bot{api: bot, chatID: cid}, nil
 }
 
+// WithChat returns a Bot bound to another chat that reuses the same API client.
+func (b *Bot) WithChat(chatID string) (*Bot, error) {
+	cid, err := strconv.ParseInt(chatID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid chat ID %q: %w", chatID, err)
+	}
+	return &Bot{api: b.api, chatID: cid}, nil
+}
+
 // ── Message formatters ────────────────────────────────────────────────────────
 
-// FormatSpikeMessage returns a visually rich HTML alert for a price spike.
-func FormatSpikeMessage(summary map[string]db.Cotizacion, umbral, diff float64, isUp bool) (string, tgbotapi.InlineKeyboardMarkup) {
-	usdt := summary["USDT"]
-	oficial := summary["usd oficial"]
-	referencial := summary["usd referencial"]
-	euro := summary["eur"]
-	oro := summary["oro"]
-	plata := summary["plata"]
-	ufv := summary["ufv"]
+// fmtInstruments returns one headline line per instrument of insts. Spreads,
+// changes and the intraday range are only drawn in the price image: with them
+// the caption would not fit in maxCaptionLen.
+func fmtInstruments(summary map[string]db.Cotizacion, insts []instrument.Instrument) []string {
+	lines := make([]string, len(insts))
+	for n, inst := range insts {
+		c := summary[inst.Key]
+		head := fmt.Sprintf("%s <b>%s</b>%s:", inst.Emoji, inst.Name, fmtDest(c.MonedaDest))
+		if inst.Single {
+			lines[n] = fmt.Sprintf("%s <code>%s</code>", head, inst.Format(c.Cotizacion))
+		} else {
+			lines[n] = fmt.Sprintf("%s 💵 <code>%s</code> · 🛒 <code>%s</code>", head, inst.Format(c.Cotizacion), inst.Format(c.Purchase))
+		}
+	}
+	return lines
+}
+
+// DetailsButton returns the inline keyboard linking to the web site, shared by every message.
+func DetailsButton() tgbotapi.InlineKeyboardMarkup {
+	return tgbotapi.NewInlineKeyboardMarkup(
+		tgbotapi.NewInlineKeyboardRow(
+			tgbotapi.NewInlineKeyboardButtonURL("💸 Ver detalles en la Web", siteURL),
+		),
+	)
+}
+
+// FormatSpikeMessage returns a visually rich HTML alert for a price spike, within
+// maxCaptionLen.
+func FormatSpikeMessage(summary map[string]db.Cotizacion, insts []instrument.Instrument, umbral, diff float64, isUp bool) (string, tgbotapi.InlineKeyboardMarkup) {
+	usdt, _ := instrument.Get(instrument.USDT)
 	pct := (math.Abs(diff) / umbral) * 100
-	generatedAt := time.Now().Format(db.DisplayTimeFmt)
+	generatedAt := time.Now().In(db.Location).Format(db.DisplayTimeFmt)
 
 	var title, dir, emoji, trend string
 	if isUp {
@@ -92,114 +130,41 @@ func FormatSpikeMessage(summary map[string]db.Cotizacion, umbral, diff float64,
 		trend = "Caída rápida"
 	}
 
-	text := strings.Join([]string{
+	head := []string{
 		title,
 		fmt.Sprintf("%s <b>Tendencia:</b> %s", emoji, trend),
-		"🏛️ <b>Mercado:</b> Binance P2P",
-		"",
-		"💰 <b>USDT (Binance):</b>" + fmtDest(usdt.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.4f</code>", usdt.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.4f</code>", usdt.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(usdt.Datetime)),
-		"",
-		"🏢 <b>BCB - USD Oficial:</b>" + fmtDest(oficial.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.2f</code>", oficial.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.2f</code>", oficial.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(oficial.Datetime)),
-		"",
-		"📊 <b>BCB - USD Referencial:</b>" + fmtDest(referencial.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.2f</code>", referencial.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.2f</code>", referencial.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(referencial.Datetime)),
+		"🏛️ <b>Mercado:</b> " + usdt.Source,
+		"💵 Venta · 🛒 Compra",
 		"",
-		"🇪🇺 <b>Euro:</b>" + fmtDest(euro.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.2f</code>", euro.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.2f</code>", euro.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(euro.Datetime)),
-		"",
-		"🥇 <b>Oro (Troy Oz):</b>" + fmtDest(oro.MonedaDest),
-		fmt.Sprintf("💵 Precio: <code>%.2f</code>", oro.Cotizacion),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(oro.Datetime)),
-		"",
-		"🥈 <b>Plata (Troy Oz):</b>" + fmtDest(plata.MonedaDest),
-		fmt.Sprintf("💵 Precio: <code>%.2f</code>", plata.Cotizacion),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(plata.Datetime)),
-		"",
-		"📐 <b>UFV:</b>" + fmtDest(ufv.MonedaDest),
-		fmt.Sprintf("💵 Valor:  <code>%.5f</code>", ufv.Cotizacion),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(ufv.Datetime)),
+	}
+	foot := []string{
 		"────────────────────────",
 		fmt.Sprintf("📊 Variación USDT: <code>%s%.4f</code> (<code>%s%.2f%%</code>)", dir, math.Abs(diff), dir, pct),
 		fmt.Sprintf("🏷️ Ref. Anterior: <code>%.4f</code>", umbral),
 		fmt.Sprintf("📅 <i>Generado: %s</i>", generatedAt),
-	}, "\n")
-
-	btn := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL("💸 Ver detalles en la Web", siteURL),
-		),
-	)
+	}
+	text := fitCaption(head, fmtInstruments(summary, insts), foot)
 
-	return text, btn
+	return text, DetailsButton()
 }
 
-// FormatDailyMessage returns a clean daily-summary HTML message.
-func FormatDailyMessage(summary map[string]db.Cotizacion) (string, tgbotapi.InlineKeyboardMarkup) {
-	usdt := summary["USDT"]
-	oficial := summary["usd oficial"]
-	referencial := summary["usd referencial"]
-	euro := summary["eur"]
-	oro := summary["oro"]
-	plata := summary["plata"]
-	ufv := summary["ufv"]
-	generatedAt := time.Now().Format(db.DisplayTimeFmt)
-
-	text := strings.Join([]string{
+// FormatDailyMessage returns a clean daily-summary HTML message, within maxCaptionLen.
+func FormatDailyMessage(summary map[string]db.Cotizacion, insts []instrument.Instrument) (string, tgbotapi.InlineKeyboardMarkup) {
+	generatedAt := time.Now().In(db.Location).Format(db.DisplayTimeFmt)
+
+	head := []string{
 		"<blockquote><b>☀️ Resumen de Cotizaciones</b></blockquote>",
-		"🏛️ <b>Mercados:</b> Binance P2P / BCB",
-		"",
-		"💰 <b>USDT (Binance):</b>" + fmtDest(usdt.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.4f</code>", usdt.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.4f</code>", usdt.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(usdt.Datetime)),
+		"🏛️ <b>Mercados:</b> " + strings.Join(instrument.Sources(insts), " / "),
+		"💵 Venta · 🛒 Compra",
 		"",
-		"🏢 <b>BCB - USD Oficial:</b>" + fmtDest(oficial.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.2f</code>", oficial.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.2f</code>", oficial.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(oficial.Datetime)),
-		"",
-		"📊 <b>BCB - USD Referencial:</b>" + fmtDest(referencial.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.2f</code>", referencial.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.2f</code>", referencial.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(referencial.Datetime)),
-		"",
-		"🇪🇺 <b>Euro:</b>" + fmtDest(euro.MonedaDest),
-		fmt.Sprintf("💵 Venta:  <code>%.2f</code>", euro.Cotizacion),
-		fmt.Sprintf("🛒 Compra: <code>%.2f</code>", euro.Purchase),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(euro.Datetime)),
-		"",
-		"🥇 <b>Oro (Troy Oz):</b>" + fmtDest(oro.MonedaDest),
-		fmt.Sprintf("💵 Precio: <code>%.2f</code>", oro.Cotizacion),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(oro.Datetime)),
-		"",
-		"🥈 <b>Plata (Troy Oz):</b>" + fmtDest(plata.MonedaDest),
-		fmt.Sprintf("💵 Precio: <code>%.2f</code>", plata.Cotizacion),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(plata.Datetime)),
-		"",
-		"📐 <b>UFV:</b>" + fmtDest(ufv.MonedaDest),
-		fmt.Sprintf("💵 Valor:  <code>%.5f</code>", ufv.Cotizacion),
-		fmt.Sprintf("🕒 <i>%s</i>", fmtDT(ufv.Datetime)),
+	}
+	foot := []string{
 		"",
 		fmt.Sprintf("📅 <i>Generado: %s</i>", generatedAt),
-	}, "\n")
-
-	btn := tgbotapi.NewInlineKeyboardMarkup(
-		tgbotapi.NewInlineKeyboardRow(
-			tgbotapi.NewInlineKeyboardButtonURL("💸 Ver detalles en la Web", siteURL),
-		),
-	)
+	}
+	text := fitCaption(head, fmtInstruments(summary, insts), foot)
 
-	return text, btn
+	return text, DetailsButton()
 }
 
 // ── Bot actions ───────────────────────────────────────────────────────────────
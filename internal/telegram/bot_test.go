@@ -0,0 +1,85 @@
+package telegram
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"cotizaciones/internal/config"
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+)
+
+// fullSummary returns a quote for every instrument of insts, with wide prices
+// and the full CriptoYa payload.
+func fullSummary(insts []instrument.Instrument) map[string]db.Cotizacion {
+	summary := make(map[string]db.Cotizacion)
+	for _, inst := range insts {
+		summary[inst.Key] = db.Cotizacion{
+			Moneda: inst.Key, MonedaDest: "BOB", Datetime: "2025-03-14 16:05:00",
+			Cotizacion: 712345.6789, Purchase: 712399.1234, Ask: 712300.5, TotalBid: 712350.25,
+		}
+	}
+	return summary
+}
+
+func TestMessagesFitInCaption(t *testing.T) {
+	saved := instrument.All
+	t.Cleanup(func() { instrument.All = saved })
+	instrument.All = append([]instrument.Instrument(nil), saved...)
+	instrument.Register(config.Instruments(config.DefaultPairs)...)
+
+	insts := instrument.All
+	summary := fullSummary(insts)
+	daily, _ := FormatDailyMessage(summary, insts)
+	spike, _ := FormatSpikeMessage(summary, insts, 6.95, -0.35, false)
+
+	for name, text := range map[string]string{"daily": daily, "spike": spike} {
+		if n := captionLen(text); n > maxCaptionLen {
+			t.Errorf("%s: caption of %d characters, limit %d", name, n, maxCaptionLen)
+		}
+		for _, inst := range insts {
+			if !strings.Contains(text, inst.Name) {
+				t.Errorf("%s: %s missing from the caption", name, inst.Name)
+			}
+		}
+	}
+}
+
+func TestMessagesTruncatedToCaption(t *testing.T) {
+	var insts []instrument.Instrument
+	for i := range 60 {
+		insts = append(insts, instrument.Instrument{Key: fmt.Sprint("x", i), Name: fmt.Sprintf("Instrumento de prueba %02d", i), Emoji: "🪙", Precision: 4})
+	}
+	summary := fullSummary(insts)
+	daily, _ := FormatDailyMessage(summary, insts)
+	spike, _ := FormatSpikeMessage(summary, insts, 6.95, 0.35, true)
+
+	for name, text := range map[string]string{"daily": daily, "spike": spike} {
+		if n := captionLen(text); n > maxCaptionLen {
+			t.Errorf("%s: caption of %d characters, limit %d", name, n, maxCaptionLen)
+		}
+		if !strings.Contains(text, insts[0].Name) || strings.Contains(text, insts[59].Name) {
+			t.Errorf("%s: want the first instruments and not the last", name)
+		}
+		if !strings.Contains(text, "instrumentos más") || !strings.Contains(text, "Generado:") {
+			t.Errorf("%s: want the truncation note and the footer:\n%s", name, text)
+		}
+	}
+}
+
+func TestCaptionLen(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int
+	}{
+		{"<b>USDT:</b> <code>6.95</code>", 10},
+		{"a &amp; b", 5},
+		{"💵 Venta", 8}, // el emoji ocupa dos unidades UTF-16
+	}
+	for _, tt := range tests {
+		if got := captionLen(tt.in); got != tt.want {
+			t.Errorf("captionLen(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
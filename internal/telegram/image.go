@@ -8,9 +8,12 @@ import (
 	"image/draw"
 	"image/png"
 	"os"
+	"strings"
 	"time"
 
 	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+	"cotizaciones/internal/stats"
 
 	qrcode "github.com/skip2/go-qrcode"
 	"golang.org/x/image/font"
@@ -19,12 +22,21 @@ import (
 	"golang.org/x/image/math/fixed"
 )
 
-// GeneratePriceImage creates a PNG with USDT, Official, Referential, Euro, Oro, Plata and UFV quotes.
-func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
-	const (
-		w = 1200
-		h = 1950
-	)
+// GeneratePriceImage creates a PNG with one row per instrument of insts. With st
+// each row gets a line with its changes and intraday range; st may be nil.
+func GeneratePriceImage(summary map[string]db.Cotizacion, st stats.Set, insts []instrument.Instrument) (string, error) {
+	const w = 1200
+	rowH := 260
+	if len(st) > 0 {
+		rowH += 30 // línea de estadísticas bajo el separador
+	}
+
+	// QRs arriba a la derecha; la imagen es al menos tan alta como ambos
+	const qrSize = 230
+	const qrMargin = 12
+	qr1Top := qrMargin + 26
+	qr2Top := qr1Top + qrSize + 20 + 26
+	h := max(90+len(insts)*rowH, qr2Top+qrSize+qrMargin)
 
 	img := image.NewRGBA(image.Rect(0, 0, w, h))
 
@@ -51,39 +63,25 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 
 	drawer := &font.Drawer{Dst: img, Src: white, Face: titleFace}
 
-	// formatDatetime: usa las constantes del paquete db, sin strings hardcodeados
-	// Si el valor incluye hora, muestra segundos; si es solo fecha, muestra solo la fecha.
-	formatDatetime := func(dt string) string {
-		layouts := []string{
-			db.TimeFmt,
-			"2006-01-02 15:04",
-			"2006-01-02",
-		}
-		for _, layout := range layouts {
-			t, err := time.Parse(layout, dt)
-			if err != nil {
-				continue
-			}
-			if layout == db.TimeFmt || layout == "2006-01-02 15:04" {
-				return t.Format(db.DisplayTimeFmt)
-			}
-			return t.Format(db.DisplayDateFmt)
-		}
-		return dt
-	}
+	// formatDatetime: convierte el datetime de la DB (UTC) a hora de La Paz
+	formatDatetime := db.Display
 
-	drawQuoteRow := func(y int, title string, c db.Cotizacion, isPrecision bool) {
+	drawQuoteRow := func(y int, title string, c db.Cotizacion, precision int) {
 		// Section title
 		drawer.Face = labelFace
 		drawer.Src = blue
 		drawer.Dot = fixed.P(60, y)
 		drawer.DrawString(title)
 
-		// Actualizado label (hora de la DB para esta moneda)
+		// Actualizado label (hora de la DB para esta moneda) + payload completo si existe
 		drawer.Face = tinyFace
 		drawer.Src = muted
 		drawer.Dot = fixed.P(62, y+28)
-		drawer.DrawString("Actualizado: " + formatDatetime(c.Datetime))
+		updated := "Actualizado: " + formatDatetime(c.Datetime)
+		if c.Ask != 0 || c.TotalBid != 0 {
+			updated += fmt.Sprintf(" · Spread s/com. %.2f%% · c/com. %.2f%%", c.RawSpreadPct(), c.AllInSpreadPct())
+		}
+		drawer.DrawString(updated)
 
 		// VENTA label + price
 		drawer.Face = smallFace
@@ -93,12 +91,8 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 
 		drawer.Face = priceFace
 		drawer.Src = white
-		vMsg := fmt.Sprintf("%.2f", c.Cotizacion)
-		if isPrecision {
-			vMsg = fmt.Sprintf("%.4f", c.Cotizacion)
-		}
 		drawer.Dot = fixed.P(80, y+175)
-		drawer.DrawString(vMsg)
+		drawer.DrawString(fmt.Sprintf("%.*f", precision, c.Cotizacion))
 
 		// COMPRA label + price
 		drawer.Face = smallFace
@@ -108,19 +102,15 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 
 		drawer.Face = priceFace
 		drawer.Src = white
-		cMsg := fmt.Sprintf("%.2f", c.Purchase)
-		if isPrecision {
-			cMsg = fmt.Sprintf("%.4f", c.Purchase)
-		}
 		drawer.Dot = fixed.P(650, y+175)
-		drawer.DrawString(cMsg)
+		drawer.DrawString(fmt.Sprintf("%.*f", precision, c.Purchase))
 
 		// Separator line
 		draw.Draw(img, image.Rect(60, y+205, w-60, y+207), &image.Uniform{C: color.RGBA{40, 50, 70, 255}}, image.Point{}, draw.Src)
 	}
 
 	// drawSingleRow draws a row with a single value (no buy/sell pair)
-	drawSingleRow := func(y int, title, valueLabel string, value float64, fmtStr string, c db.Cotizacion) {
+	drawSingleRow := func(y int, title, valueLabel string, c db.Cotizacion, precision int) {
 		drawer.Face = labelFace
 		drawer.Src = blue
 		drawer.Dot = fixed.P(60, y)
@@ -139,11 +129,30 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 		drawer.Face = priceFace
 		drawer.Src = white
 		drawer.Dot = fixed.P(80, y+175)
-		drawer.DrawString(fmt.Sprintf(fmtStr, value))
+		drawer.DrawString(fmt.Sprintf("%.*f", precision, c.Cotizacion))
 
 		draw.Draw(img, image.Rect(60, y+205, w-60, y+207), &image.Uniform{C: color.RGBA{40, 50, 70, 255}}, image.Point{}, draw.Src)
 	}
 
+	// drawStatsLine draws the changes and intraday range under the separator of a row
+	drawStatsLine := func(y int, inst instrument.Instrument) {
+		s, ok := st[inst.Key]
+		if !ok {
+			return
+		}
+		var parts []string
+		for _, c := range s.Changes {
+			parts = append(parts, fmt.Sprintf("%s %+.2f%%", c.Period, c.Pct))
+		}
+		if s.Samples > 1 {
+			parts = append(parts, fmt.Sprintf("Hoy %s – %s", inst.Format(s.Low), inst.Format(s.High)))
+		}
+		drawer.Face = tinyFace
+		drawer.Src = muted
+		drawer.Dot = fixed.P(62, y+236)
+		drawer.DrawString(strings.Join(parts, " · "))
+	}
+
 	// destSuffix returns " (BOB)" etc. if moneda_dest is set
 	destSuffix := func(c db.Cotizacion) string {
 		if c.MonedaDest == "" {
@@ -159,8 +168,6 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 	drawer.DrawString("COTIZACIONES")
 
 	// Draw QR codes top-right
-	const qrSize = 230
-	const qrMargin = 12
 	drawQR := func(url string, xRight, yTop int) {
 		pngBytes, err2 := qrcode.Encode(url, qrcode.Medium, qrSize)
 		if err2 != nil {
@@ -177,7 +184,6 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 
 	// QR 1: Telegram
 	qr1TitleY := qrMargin + 22
-	qr1Top := qrMargin + 26
 	drawer.Face = tinyFace
 	drawer.Src = muted
 	drawer.Dot = fixed.P(qrX, qr1TitleY)
@@ -186,39 +192,29 @@ func GeneratePriceImage(summary map[string]db.Cotizacion) (string, error) {
 
 	// QR 2: Website
 	qr2TitleY := qr1Top + qrSize + 20 + 22
-	qr2Top := qr1Top + qrSize + 20 + 26
 	drawer.Face = tinyFace
 	drawer.Src = muted
 	drawer.Dot = fixed.P(qrX, qr2TitleY)
 	drawer.DrawString("Website")
 	drawQR("https://dolarbolivia.org", qrX, qr2Top)
 
-	// 1. USDT         (y=100)
-	drawQuoteRow(100, "USDT – BINANCE P2P"+destSuffix(summary["USDT"]), summary["USDT"], true)
-
-	// 2. Oficial      (y=360)
-	drawQuoteRow(360, "USD OFICIAL – BCB"+destSuffix(summary["usd oficial"]), summary["usd oficial"], false)
-
-	// 3. Referencial  (y=620)
-	drawQuoteRow(620, "USD REFERENCIAL – BCB"+destSuffix(summary["usd referencial"]), summary["usd referencial"], false)
-
-	// 4. Euro         (y=880)
-	drawQuoteRow(880, "EURO – BCB"+destSuffix(summary["eur"]), summary["eur"], false)
-
-	// 5. Oro          (y=1140)
-	drawSingleRow(1140, "ORO (TROY OZ) – BCB"+destSuffix(summary["oro"]), "PRECIO", summary["oro"].Cotizacion, "%.2f", summary["oro"])
-
-	// 6. Plata        (y=1400)
-	drawSingleRow(1400, "PLATA (TROY OZ) – BCB"+destSuffix(summary["plata"]), "PRECIO", summary["plata"].Cotizacion, "%.2f", summary["plata"])
-
-	// 7. UFV          (y=1660)
-	drawSingleRow(1660, "UFV – BCB"+destSuffix(summary["ufv"]), "VALOR", summary["ufv"].Cotizacion, "%.5f", summary["ufv"])
+	// Una fila por instrumento, en el orden del registro
+	for n, inst := range insts {
+		y := 100 + n*rowH
+		c := summary[inst.Key]
+		if inst.Single {
+			drawSingleRow(y, inst.Title+destSuffix(c), strings.ToUpper(inst.ValueLabel), c, inst.Precision)
+		} else {
+			drawQuoteRow(y, inst.Title+destSuffix(c), c, inst.Precision)
+		}
+		drawStatsLine(y, inst)
+	}
 
 	// Footer global (hora de generación de la imagen)
 	drawer.Face = tinyFace
 	drawer.Src = muted
 	drawer.Dot = fixed.P(60, h-18)
-	drawer.DrawString("Generado: " + time.Now().Format(db.DisplayTimeFmt))
+	drawer.DrawString("Generado: " + time.Now().In(db.Location).Format(db.DisplayTimeFmt))
 
 	path, err := os.CreateTemp("", "cotizacion-*.png")
 	if err != nil {
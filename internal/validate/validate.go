@@ -0,0 +1,149 @@
+package validate
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"cotizaciones/internal/api"
+	"cotizaciones/internal/db"
+)
+
+// Rules configures the sanity checks applied to fetched quotes before they are stored.
+type Rules struct {
+	// MaxDeviationPct is the maximum allowed change, in percent, against the last
+	// stored row of the same moneda/exchange. Zero disables the check.
+	MaxDeviationPct float64
+	// MaxSourceAge is the maximum age of the source timestamp before a quote is
+	// considered stale. Zero disables the check.
+	MaxSourceAge time.Duration
+}
+
+// DefaultRules are used when MAX_DEVIATION_PCT / MAX_SOURCE_AGE are not set.
+var DefaultRules = Rules{MaxDeviationPct: 10, MaxSourceAge: 30 * time.Minute}
+
+// RulesFromEnv returns DefaultRules overridden by the MAX_DEVIATION_PCT and
+// MAX_SOURCE_AGE environment variables.
+func RulesFromEnv() (Rules, error) {
+	r := DefaultRules
+	if v := os.Getenv("MAX_DEVIATION_PCT"); v != "" {
+		pct, err := strconv.ParseFloat(v, 64)
+		if err != nil || pct < 0 {
+			return r, fmt.Errorf("MAX_DEVIATION_PCT inválido %q", v)
+		}
+		r.MaxDeviationPct = pct
+	}
+	if v := os.Getenv("MAX_SOURCE_AGE"); v != "" {
+		age, err := time.ParseDuration(v)
+		if err != nil || age < 0 {
+			return r, fmt.Errorf("MAX_SOURCE_AGE inválido %q", v)
+		}
+		r.MaxSourceAge = age
+	}
+	return r, nil
+}
+
+// Rejection describes why a quote was not accepted.
+type Rejection struct {
+	Reason string
+}
+
+func (e *Rejection) Error() string { return "cotización rechazada: " + e.Reason }
+
+func reject(format string, args ...any) error {
+	return &Rejection{Reason: fmt.Sprintf(format, args...)}
+}
+
+// Check validates q against impossible values, bid/ask consistency and, when last is
+// not nil, the maximum deviation from the previously stored row. It returns a
+// *Rejection when the quote must be quarantined.
+func (r Rules) Check(q api.Quote, last *db.Cotizacion) error {
+	if !positive(q.Bid) {
+		return reject("bid inválido (%v)", q.Bid)
+	}
+	if !positive(q.TotalAsk) {
+		return reject("totalAsk inválido (%v)", q.TotalAsk)
+	}
+	if q.Ask != 0 && !positive(q.Ask) {
+		return reject("ask inválido (%v)", q.Ask)
+	}
+	if q.Ask > 0 && q.Bid > q.Ask {
+		return reject("bid %.4f mayor que ask %.4f", q.Bid, q.Ask)
+	}
+	if q.Bid > q.TotalAsk {
+		return reject("bid %.4f mayor que totalAsk %.4f", q.Bid, q.TotalAsk)
+	}
+
+	if last == nil || r.MaxDeviationPct <= 0 {
+		return nil
+	}
+	if pct, ok := deviation(q.Bid, last.Cotizacion); ok && pct > r.MaxDeviationPct {
+		return reject("bid %.4f se desvía %.2f%% del último valor %.4f (máx %.2f%%)", q.Bid, pct, last.Cotizacion, r.MaxDeviationPct)
+	}
+	if pct, ok := deviation(q.TotalAsk, last.Purchase); ok && pct > r.MaxDeviationPct {
+		return reject("totalAsk %.4f se desvía %.2f%% del último valor %.4f (máx %.2f%%)", q.TotalAsk, pct, last.Purchase, r.MaxDeviationPct)
+	}
+	return nil
+}
+
+// CheckCotizacion validates a row read from a source that publishes venta in
+// Cotizacion and compra in Purchase (BCB): positive values, compra not above
+// venta and, when last is not nil, the maximum deviation from the previously
+// stored row. Purchase is zero for single-value rates. It returns a *Rejection
+// when the row must be quarantined.
+func (r Rules) CheckCotizacion(c db.Cotizacion, last *db.Cotizacion) error {
+	if !positive(c.Cotizacion) {
+		return reject("venta inválida (%v)", c.Cotizacion)
+	}
+	if c.Purchase != 0 && !positive(c.Purchase) {
+		return reject("compra inválida (%v)", c.Purchase)
+	}
+	if c.Purchase > c.Cotizacion {
+		return reject("compra %.4f mayor que venta %.4f", c.Purchase, c.Cotizacion)
+	}
+
+	if last == nil || r.MaxDeviationPct <= 0 {
+		return nil
+	}
+	if pct, ok := deviation(c.Cotizacion, last.Cotizacion); ok && pct > r.MaxDeviationPct {
+		return reject("venta %.4f se desvía %.2f%% del último valor %.4f (máx %.2f%%)", c.Cotizacion, pct, last.Cotizacion, r.MaxDeviationPct)
+	}
+	if c.Purchase != 0 {
+		if pct, ok := deviation(c.Purchase, last.Purchase); ok && pct > r.MaxDeviationPct {
+			return reject("compra %.4f se desvía %.2f%% del último valor %.4f (máx %.2f%%)", c.Purchase, pct, last.Purchase, r.MaxDeviationPct)
+		}
+	}
+	return nil
+}
+
+// Stale reports whether q is an old reading that must not be stored nor trigger alerts:
+// either the API returned the same cached snapshot already stored in last, or the
+// source timestamp is older than MaxSourceAge. Quotes without a source time are never stale.
+func (r Rules) Stale(q api.Quote, last *db.Cotizacion, now time.Time) (reason string, stale bool) {
+	st := q.SourceTime()
+	if st.IsZero() {
+		return "", false
+	}
+	if last != nil && last.SourceDatetime == db.FormatTime(st) {
+		return fmt.Sprintf("snapshot repetido (fuente %s)", last.SourceDatetime), true
+	}
+	if r.MaxSourceAge > 0 && now.Sub(st) > r.MaxSourceAge {
+		return fmt.Sprintf("snapshot de hace %s (máx %s)", now.Sub(st).Round(time.Second), r.MaxSourceAge), true
+	}
+	return "", false
+}
+
+// positive reports whether v is a finite number greater than zero.
+func positive(v float64) bool {
+	return v > 0 && !math.IsInf(v, 0) && !math.IsNaN(v)
+}
+
+// deviation returns the absolute percent change of v against ref; ok is false if ref is unusable.
+func deviation(v, ref float64) (float64, bool) {
+	if !positive(ref) {
+		return 0, false
+	}
+	return math.Abs(v-ref) / ref * 100, true
+}
@@ -0,0 +1,48 @@
+package validate
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"cotizaciones/internal/db"
+)
+
+func TestCheckCotizacion(t *testing.T) {
+	rules := Rules{MaxDeviationPct: 10}
+	last := &db.Cotizacion{Moneda: "eur", Exchange: "bcb", Cotizacion: 7.61, Purchase: 7.45}
+	lastOro := &db.Cotizacion{Moneda: "oro", Exchange: "bcb", Cotizacion: 2936.45}
+
+	tests := []struct {
+		name    string
+		c       db.Cotizacion
+		last    *db.Cotizacion
+		wantErr string
+	}{
+		{name: "compra/venta", c: db.Cotizacion{Cotizacion: 7.65, Purchase: 7.48}, last: last},
+		{name: "first row", c: db.Cotizacion{Cotizacion: 7.65, Purchase: 7.48}},
+		{name: "single value", c: db.Cotizacion{Cotizacion: 2950}, last: lastOro},
+		{name: "venta zero", c: db.Cotizacion{Cotizacion: 0, Purchase: 7.48}, wantErr: "venta inválida"},
+		{name: "compra negative", c: db.Cotizacion{Cotizacion: 7.65, Purchase: -1}, wantErr: "compra inválida"},
+		{name: "compra above venta", c: db.Cotizacion{Cotizacion: 7.45, Purchase: 7.61}, wantErr: "compra 7.6100 mayor que venta 7.4500"},
+		{name: "venta deviates", c: db.Cotizacion{Cotizacion: 76.1, Purchase: 7.45}, last: last, wantErr: "venta 76.1000 se desvía"},
+		{name: "compra deviates", c: db.Cotizacion{Cotizacion: 7.61, Purchase: 0.745}, last: last, wantErr: "compra 0.7450 se desvía"},
+		{name: "single value deviates", c: db.Cotizacion{Cotizacion: 293.645}, last: lastOro, wantErr: "venta 293.6450 se desvía"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := rules.CheckCotizacion(tt.c, tt.last)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var rej *Rejection
+			if !errors.As(err, &rej) || !strings.Contains(rej.Reason, tt.wantErr) {
+				t.Fatalf("got %v, want a rejection mentioning %q", err, tt.wantErr)
+			}
+		})
+	}
+}
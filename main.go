@@ -1,26 +1,44 @@
 package main
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
 	"math"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"cotizaciones/internal/api"
+	"cotizaciones/internal/archive"
+	"cotizaciones/internal/config"
 	"cotizaciones/internal/db"
 	"cotizaciones/internal/git"
+	"cotizaciones/internal/instrument"
+	"cotizaciones/internal/stats"
 	"cotizaciones/internal/telegram"
 	"cotizaciones/internal/ui"
+	"cotizaciones/internal/validate"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 	"github.com/joho/godotenv"
 )
 
 const (
-	jsonOutputPath = "/opt/codes/cotizaciones_ng/docs/data.json"
-	ngRepoPath     = "/opt/codes/cotizaciones_ng"
-	totalSteps     = 8
+	jsonOutputPath  = "/opt/codes/cotizaciones_ng/docs/data.json"
+	statsOutputPath = "/opt/codes/cotizaciones_ng/docs/stats.json"
+	ngRepoPath      = "/opt/codes/cotizaciones_ng"
+	totalSteps      = 8
+	fetchTimeout    = 60 * time.Second
+
+	// primaryMoneda/primaryExchange identify the quote that drives Telegram alerts
+	primaryMoneda   = instrument.USDT
+	primaryExchange = "binancep2p"
 )
 
 func main() {
@@ -30,185 +48,272 @@ func main() {
 		ui.Warn(".env no encontrado, usando variables de entorno del sistema")
 	}
 
+	dbOpts, err := db.OptionsFromEnv()
+	if err != nil {
+		exitWithError("Configuración de base de datos inválida: %v", err)
+	}
+	if len(os.Args) > 1 {
+		if run, ok := commands[os.Args[1]]; ok {
+			run(dbOpts, os.Args[2:])
+			return
+		}
+	}
+	dbOpts.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
 	token := os.Getenv("TELEGRAM_BOT_TOKEN")
 	if token == "" {
 		ui.Fatal("TELEGRAM_BOT_TOKEN es requerido")
 		os.Exit(1)
 	}
 
-	// 1. Fetch cotizacion from API
-	ui.StepStart(1, totalSteps, "🌐", "Consultando API de CriptoYa...")
-	data, err := api.FetchCotizacion()
+	// inicio de la corrida: lo que quedó en el outbox antes es de una corrida anterior
+	runStart := time.Now()
+
+	rules, err := validate.RulesFromEnv()
 	if err != nil {
-		exitWithError("Error consultando API: %v", err)
+		exitWithError("Configuración inválida: %v", err)
 	}
-	ui.Success("Respuesta recibida correctamente")
-	ui.Prices(data.Bid, data.TotalAsk)
 
-	// 2. Open database
-	ui.StepStart(2, totalSteps, "🗄️", "Conectando a base de datos SQLite...")
-	database, err := db.New()
+	pairs, err := config.LoadPairs()
 	if err != nil {
-		exitWithError("Error abriendo base de datos: %v", err)
+		exitWithError("Configuración de pares inválida: %v", err)
 	}
-	defer database.Close()
-	ui.Success("Conexión establecida")
-
-	// 3. Insert cotizacion
-	ui.StepStart(3, totalSteps, "💾", "Guardando cotización en base de datos...")
-	if err := database.InsertCotizacion(data.Bid, data.TotalAsk); err != nil {
-		exitWithError("Error guardando cotización: %v", err)
+	if err := instrument.Register(config.Instruments(pairs)...); err != nil {
+		ui.Warn(fmt.Sprintf("Configuración de pares: %v", err))
 	}
-	ui.Success("Cotización guardada → moneda=USDT exchange=binancep2p")
-	ui.Info(fmt.Sprintf("bid=%.2f  purchase=%.2f  time=%s", data.Bid, data.TotalAsk, time.Now().Format("2006-01-02 15:04:05")))
-
-	// 4. Telegram (non-fatal: errores no cortan el flujo)
-	ui.StepStart(4, totalSteps, "📨", "Procesando notificación de Telegram...")
 
-	summary, err := database.GetLatestSummary()
-	if err != nil {
-		ui.Warn(fmt.Sprintf("Error obteniendo resumen para Telegram: %v", err))
+	// 1. Fetch cotizaciones from every configured pair
+	ui.StepStart(1, totalSteps, "🌐", fmt.Sprintf("Consultando %d pares configurados...", len(pairs)))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	fetchCtx, cancelFetch := context.WithTimeout(ctx, fetchTimeout)
+	var quotes []api.Quote
+	for _, pair := range pairs {
+		src, err := pair.NewSource()
+		if err != nil {
+			ui.Warn(fmt.Sprintf("%s: %v", pair.DisplayName, err))
+			continue
+		}
+		qs, err := src.Fetch(fetchCtx)
+		if err != nil {
+			var rl *api.RateLimitError
+			switch {
+			case ctx.Err() != nil:
+				exitWithError("Consulta cancelada: %v", err)
+			case errors.As(err, &rl):
+				ui.Warn(fmt.Sprintf("%s (%s) limitó las consultas, se omite: %v", src.Name(), src.Instrument(), err))
+			default:
+				ui.Warn(fmt.Sprintf("Error consultando %s (%s): %v", src.Name(), src.Instrument(), err))
+			}
+			continue
+		}
+		ui.Success(fmt.Sprintf("Respuesta recibida → %s (%s)", pair.DisplayName, src.Name()))
+		if bestBid, bestAsk, ok := api.Best(qs); ok && len(qs) > 1 {
+			ui.Info(fmt.Sprintf("Mejor venta: %s (%s)  ·  Mejor compra: %s (%s)  ·  %d mercados",
+				pair.Format(bestBid.Bid), bestBid.Exchange, pair.Format(bestAsk.TotalAsk), bestAsk.Exchange, len(qs)))
+		}
+		quotes = append(quotes, qs...)
 	}
-
-	imagePath, imageErr := telegram.GeneratePriceImage(summary)
-	if imageErr != nil {
-		ui.Warn(fmt.Sprintf("No se pudo generar la imagen de cotización: %v", imageErr))
+	var bcbRows []db.Cotizacion
+	if os.Getenv("FETCH_BCB") != "false" {
+		bcbRows, err = api.NewBCB().Fetch(fetchCtx)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("Error consultando BCB: %v", err))
+		} else {
+			ui.Success(fmt.Sprintf("BCB → %d tipos de cambio", len(bcbRows)))
+		}
 	}
-	if imagePath != "" {
-		defer os.Remove(imagePath)
+	cancelFetch()
+	data, ok := findQuote(quotes, primaryMoneda, primaryExchange)
+	if !ok {
+		exitWithError("Sin cotización de %s en %s", primaryMoneda, primaryExchange)
 	}
+	ui.Prices(data.Bid, data.TotalAsk)
 
-	cfg, err := database.GetConfig()
+	// 2. Open database
+	ui.StepStart(2, totalSteps, "🗄️", "Conectando a base de datos SQLite...")
+	database, err := db.New(dbOpts)
 	if err != nil {
-		ui.Warn(fmt.Sprintf("Error leyendo config, saltando Telegram: %v", err))
-	} else {
-		bot, err := telegram.New(token, cfg.ChatID)
-		if err != nil {
-			ui.Warn(fmt.Sprintf("Error creando bot de Telegram, saltando: %v", err))
-		} else {
-			ui.Success("Bot de Telegram conectado")
-			today := time.Now().Format("2006-01-02")
-
-			const spikeThreshold = 0.20
-			hasMessage := cfg.MessageID.Valid && cfg.MessageID.String != ""
+		exitWithError("Error abriendo base de datos: %v", err)
+	}
+	defer database.Close()
+	ui.Success(fmt.Sprintf("Conexión establecida → %s", dbOpts.Path))
+	if n, cutoff, err := database.PendingUTCShift(ctx); err != nil {
+		ui.Warn(fmt.Sprintf("Error verificando el paso a UTC: %v", err))
+	} else if n > 0 {
+		ui.Warn(fmt.Sprintf("%d cotizaciones anteriores al paso a UTC (%s) sin conversión registrada: "+
+			"ejecute shift-utc -offset 4h, o shift-utc -mark si ya están en UTC", n, cutoff))
+	}
 
-			usdRef := summary["usd referencial"]
+	// 3. Validate and insert cotizaciones (rejected samples go to quarantine) and
+	// queue the Telegram notifications they cause, all in one transaction
+	ui.StepStart(3, totalSteps, "💾", "Guardando cotizaciones en base de datos...")
+	err = database.WithTx(ctx, func(tx db.Store) error {
+		// lo pendiente de corridas anteriores no se entrega tal cual: se vuelve a
+		// planificar con los precios actuales (at-least-once, ver 0008_outbox.sql)
+		expired, err := tx.ExpireOutbox(ctx, runStart)
+		if err != nil {
+			return err
+		}
+		if expired > 0 {
+			ui.Warn(fmt.Sprintf("%d notificaciones de corridas anteriores sin entrega registrada, se vuelven a planificar", expired))
+		}
 
-			// umbral USDT (cfg.Umbral): referencia para calcular cambios de precio
-			usdtUmbralNull := !cfg.Umbral.Valid
-			currentUmbralUSDT := data.Bid
-			if !usdtUmbralNull {
-				currentUmbralUSDT = cfg.Umbral.Float64
+		primaryAccepted, skipReason := false, ""
+		for _, q := range quotes {
+			primary := q.Moneda == primaryMoneda && q.Exchange == primaryExchange
+			var last *db.Cotizacion
+			if prev, err := tx.GetLatestByExchange(ctx, q.Moneda, q.Exchange); err == nil {
+				last = &prev
+			} else if !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("error leyendo última cotización %s/%s: %w", q.Moneda, q.Exchange, err)
 			}
-
-			// umbral USD Referencial (cfg.UmbralReferencial): referencia para cambios de precio
-			refUmbralNull := !cfg.UmbralReferencial.Valid
-			currentUmbralRef := usdRef.Cotizacion
-			if !refUmbralNull {
-				currentUmbralRef = cfg.UmbralReferencial.Float64
+			if reason, stale := rules.Stale(q, last, time.Now()); stale {
+				ui.Info(fmt.Sprintf("%s/%s sin cambios en la fuente, se omite: %s", q.Moneda, q.Exchange, reason))
+				if primary {
+					skipReason = "sin cambios en la fuente: " + reason
+				}
+				continue
 			}
-
-			// Si no hay umbrales definidos, guardamos las referencias actuales y no hacemos nada más.
-			hasUmbrales := !usdtUmbralNull && !refUmbralNull
-			if !hasUmbrales {
-				ui.Info("Sin umbrales definidos — guardando referencias y omitiendo notificación de Telegram.")
-				saveConfig := func(msgID string) {
-					if err := database.UpdateConfig(today, msgID, data.Bid, usdRef.Cotizacion); err != nil {
-						ui.Warn(fmt.Sprintf("Error guardando config: %v", err))
-					}
+			if err := rules.Check(q, last); err != nil {
+				ui.Warn(fmt.Sprintf("%s/%s en cuarentena: %v", q.Moneda, q.Exchange, err))
+				if err := tx.InsertQuarantine(ctx, q.Moneda, q.Exchange, q.Bid, q.TotalAsk, err.Error()); err != nil {
+					return fmt.Errorf("error guardando cuarentena %s/%s: %w", q.Moneda, q.Exchange, err)
+				}
+				if primary {
+					skipReason = "en cuarentena: " + err.Error()
 				}
-				saveConfig(cfg.MessageID.String)
-				return
+				continue
 			}
-
-			diffUSDT := data.Bid - currentUmbralUSDT
-			diffRef := usdRef.Cotizacion - currentUmbralRef
-
-			outsideUSDT := math.Abs(diffUSDT) > spikeThreshold
-			outsideRef := math.Abs(diffRef) > spikeThreshold
-			isOutside := outsideUSDT || outsideRef
-
-			// diff principal para el mensaje de spike (el mayor)
-			diff := diffUSDT
-			if math.Abs(diffRef) > math.Abs(diffUSDT) {
-				diff = diffRef
+			c := toCotizacion(q)
+			written, err := tx.InsertCotizacion(ctx, c)
+			if err != nil {
+				return fmt.Errorf("error guardando cotización %s/%s: %w", q.Moneda, q.Exchange, err)
 			}
-
-			// tryS: envía foto si existe; si falla cae a texto
-			tryS := func(text string, silent bool, btn tgbotapi.InlineKeyboardMarkup) (int, error) {
-				if imagePath != "" {
-					id, e := bot.SendPhoto(imagePath, text, silent, btn)
-					if e == nil {
-						return id, nil
-					}
-					ui.Warn(fmt.Sprintf("Foto falló (%v), enviando texto...", e))
+			if !written {
+				ui.Info(fmt.Sprintf("%s/%s igual a la cotización anterior, se omite", q.Moneda, q.Exchange))
+				if primary {
+					skipReason = "igual a la cotización anterior"
 				}
-				return bot.SendMessage(text, silent, btn)
+				continue
+			}
+			if primary {
+				primaryAccepted = true
 			}
+			ui.Success(fmt.Sprintf("Cotización guardada → moneda=%s exchange=%s", q.Moneda, q.Exchange))
+			ui.Info(fmt.Sprintf("bid=%.2f  totalBid=%.2f  ask=%.2f  totalAsk=%.2f  time=%s  source=%s",
+				q.Bid, q.TotalBid, q.Ask, q.TotalAsk, time.Now().In(db.Location).Format(db.TimeFmt), c.SourceDatetime))
+		}
 
-			// saveConfig: guarda messageID y ambos umbrales con los precios actuales
-			saveConfig := func(msgID string) {
-				if err := database.UpdateConfig(today, msgID, data.Bid, usdRef.Cotizacion); err != nil {
-					ui.Warn(fmt.Sprintf("Error guardando config: %v", err))
+		for _, c := range bcbRows {
+			prev, err := tx.GetLatestByMoneda(ctx, c.Moneda)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("error leyendo última cotización %s: %w", c.Moneda, err)
+			}
+			var last *db.Cotizacion
+			if err == nil {
+				if sameBCBReading(prev, c) {
+					ui.Info(fmt.Sprintf("%s sin cambios (BCB %s), se omite", c.Moneda, c.SourceDatetime))
+					continue
 				}
+				last = &prev
 			}
-
-			// saveMessageID: actualiza solo el messageID, sin cambiar los umbrales existentes
-			saveMessageID := func(msgID string) {
-				if err := database.UpdateConfigMessageID(today, msgID); err != nil {
-					ui.Warn(fmt.Sprintf("Error guardando messageID en config: %v", err))
+			if err := rules.CheckCotizacion(c, last); err != nil {
+				ui.Warn(fmt.Sprintf("%s/%s en cuarentena: %v", c.Moneda, c.Exchange, err))
+				if err := tx.InsertQuarantine(ctx, c.Moneda, c.Exchange, c.Cotizacion, c.Purchase, err.Error()); err != nil {
+					return fmt.Errorf("error guardando cuarentena %s/%s: %w", c.Moneda, c.Exchange, err)
 				}
+				continue
+			}
+			written, err := tx.InsertCotizacion(ctx, c)
+			if err != nil {
+				return fmt.Errorf("error guardando cotización %s: %w", c.Moneda, err)
+			}
+			if !written {
+				ui.Info(fmt.Sprintf("%s igual a la cotización anterior, se omite", c.Moneda))
+				continue
 			}
+			ui.Success(fmt.Sprintf("Cotización guardada → moneda=%s exchange=%s valor=%.5f", c.Moneda, c.Exchange, c.Cotizacion))
+		}
 
-			switch {
+		if !primaryAccepted {
+			ui.Warn(fmt.Sprintf("Cotización %s/%s no guardada (%s), sin notificaciones nuevas", primaryMoneda, primaryExchange, skipReason))
+			return skipNotifications(ctx, tx, data.Bid, fmt.Sprintf("cotización %s/%s %s", primaryMoneda, primaryExchange, skipReason))
+		}
+		return planNotifications(ctx, tx, data.Bid)
+	})
+	if err != nil {
+		exitWithError("Transacción revertida, no se guardó nada: %v", err)
+	}
 
-			case !hasMessage:
-				ui.Info("Sin messageID — enviando mensaje nuevo...")
-				msg, btn := telegram.FormatDailyMessage(summary)
-				newID, e := tryS(msg, true, btn)
-				if e != nil {
-					ui.Warn(fmt.Sprintf("Error enviando mensaje: %v", e))
-				} else {
-					ui.Success(fmt.Sprintf("Mensaje enviado → msgID=%d", newID))
-					saveMessageID(strconv.Itoa(newID))
-				}
+	// estadísticas de la corrida, una vez con lo ya guardado: las usan la imagen
+	// de Telegram y stats.json
+	// un instrumento sin estadísticas se omite: los demás siguen en la imagen y stats.json
+	st, err := stats.Compute(ctx, database, instrument.All)
+	if err != nil {
+		ui.Warn(fmt.Sprintf("Error calculando estadísticas: %v", err))
+	}
 
-			case isOutside:
-				ui.Info(fmt.Sprintf("🚨 Fuera del umbral: USDT=%.4f(dif=%+.4f) Ref=%.4f(dif=%+.4f)",
-					data.Bid, diffUSDT, usdRef.Cotizacion, diffRef))
-				msg, btn := telegram.FormatSpikeMessage(summary, currentUmbralUSDT, diff, diff > 0)
-				newID, e := tryS(msg, false, btn)
-				if e != nil {
-					ui.Warn(fmt.Sprintf("Error enviando spike: %v", e))
-				} else {
-					ui.Success(fmt.Sprintf("Spike enviado → nuevo msgID=%d", newID))
-					saveConfig(strconv.Itoa(newID))
-				}
+	// 4. Telegram: entrega del outbox (non-fatal: errores no cortan el flujo)
+	ui.StepStart(4, totalSteps, "📨", "Procesando notificaciones de Telegram...")
+
+	pending, err := database.GetPendingOutbox(ctx)
+	switch {
+	case err != nil:
+		ui.Warn(fmt.Sprintf("Error leyendo notificaciones pendientes, saltando Telegram: %v", err))
+	case len(pending) == 0:
+		ui.Info("Sin notificaciones pendientes")
+	default:
+		bot, err := telegram.New(token, pending[0].ChatID)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("Error creando bot de Telegram, saltando: %v", err))
+			break
+		}
+		ui.Success("Bot de Telegram conectado")
 
-			default:
-				mid, _ := strconv.Atoi(cfg.MessageID.String)
-				ui.Info(fmt.Sprintf("Actualizando mensaje existente (id=%d)...", mid))
-				msg, btn := telegram.FormatDailyMessage(summary)
-				var editErr error
-				if imagePath != "" {
-					editErr = bot.EditPhoto(mid, imagePath, msg, btn)
-				} else {
-					editErr = bot.EditMessage(mid, msg, btn)
+		summary, err := database.GetLatestSummary(ctx)
+		if err != nil {
+			ui.Warn(fmt.Sprintf("Error obteniendo resumen para Telegram: %v", err))
+		}
+
+		// una imagen por selección de instrumentos, compartida entre suscriptores
+		images := make(map[string]string)
+		defer func() {
+			for _, p := range images {
+				if p != "" {
+					os.Remove(p)
 				}
-				if editErr != nil {
-					ui.Warn(fmt.Sprintf("No se pudo editar (%v) — enviando nuevo...", editErr))
-					newID, e := tryS(msg, true, btn)
-					if e != nil {
-						ui.Warn(fmt.Sprintf("Error enviando fallback: %v", e))
-					} else {
-						ui.Success(fmt.Sprintf("Nuevo mensaje enviado → msgID=%d", newID))
-						saveMessageID(strconv.Itoa(newID))
-					}
-				} else {
-					ui.Success("Mensaje actualizado correctamente")
-					saveMessageID(strconv.Itoa(mid))
+			}
+		}()
+		imageFor := func(insts []instrument.Instrument) string {
+			keys := make([]string, len(insts))
+			for i, inst := range insts {
+				keys[i] = inst.Key
+			}
+			key := strings.Join(keys, ",")
+			if p, ok := images[key]; ok {
+				return p
+			}
+			p, err := telegram.GeneratePriceImage(summary, st, insts)
+			if err != nil {
+				ui.Warn(fmt.Sprintf("No se pudo generar la imagen de cotización: %v", err))
+			}
+			images[key] = p
+			return p
+		}
+
+		for _, m := range pending {
+			ui.Info(fmt.Sprintf("Notificación %d: %s para chat %s", m.ID, m.Kind, m.ChatID))
+			subBot, err := bot.WithChat(m.ChatID)
+			if err != nil {
+				ui.Warn(fmt.Sprintf("Chat %s inválido, se descarta: %v", m.ChatID, err))
+				if err := database.CompleteOutbox(ctx, m.ID, db.OutboxFailed, 0, err.Error()); err != nil {
+					ui.Warn(fmt.Sprintf("Error marcando notificación %d: %v", m.ID, err))
 				}
+				continue
 			}
+			deliverOutbox(ctx, database, subBot, m, imageFor(instrument.Select(m.Instruments)))
 		}
 	}
 
@@ -221,10 +326,16 @@ func main() {
 
 	// 5. Export all cotizaciones to JSON
 	ui.StepStart(5, totalSteps-1, "📄", "Exportando cotizaciones a JSON...")
-	if err := database.ExportCotizacionesToJSON(jsonOutputPath); err != nil {
+	if err := database.ExportCotizacionesToJSON(ctx, jsonOutputPath); err != nil {
 		exitWithError("Error exportando JSON: %v", err)
 	}
 	ui.Success(fmt.Sprintf("Archivo generado → %s", jsonOutputPath))
+	// las estadísticas no cortan la corrida: sin stats.json nuevo se sube igual data.json
+	if err := stats.WriteJSON(statsOutputPath, st); err != nil {
+		ui.Warn(fmt.Sprintf("Error exportando estadísticas: %v", err))
+	} else {
+		ui.Success(fmt.Sprintf("Archivo generado → %s", statsOutputPath))
+	}
 
 	// 6. Git commit and push
 	ui.StepStart(6, totalSteps-1, "🚀", "Subiendo cambios al repositorio (git push)...")
@@ -234,21 +345,310 @@ func main() {
 	}
 	ui.Success("Cambios subidos correctamente")
 
-	// 7. Cleanup old cotizaciones (older than 30 days)
-	ui.StepStart(7, totalSteps-1, "🧹", "Limpiando registros antiguos (> 30 días)...")
-	deleted, err := database.DeleteOlderThan(30 * 24 * time.Hour)
-	if err != nil {
+	// 7. Roll up, archive and cleanup old cotizaciones (retention per moneda/exchange)
+	ui.StepStart(7, totalSteps-1, "🧹", "Consolidando y limpiando registros antiguos (retención por instrumento)...")
+	// archivar es opcional: sin ARCHIVE_DIR los registros eliminados se descartan
+	archiveDir := os.Getenv("ARCHIVE_DIR")
+	if archiveDir != "" {
+		database.SetArchiver(archive.New(archiveDir).Append)
+	}
+	pruned, err := database.PruneByPolicy(ctx)
+	if errors.Is(err, db.ErrArchive) {
+		// la transacción se revirtió: nada se eliminó y se reintenta en la próxima ejecución
+		ui.Warn(fmt.Sprintf("No se pudo archivar, limpieza omitida en esta ejecución: %v", err))
+	} else if err != nil {
 		exitWithError("Error limpiando registros: %v", err)
 	}
-	if deleted > 0 {
+	var deleted int64
+	for _, p := range pruned {
+		if p.Deleted == 0 {
+			continue
+		}
+		deleted += p.Deleted
+		ui.Info(fmt.Sprintf("%s/%s: eliminados %d (> %d días, anteriores a %s) · agregados %d horas, %d días",
+			p.Moneda, p.Exchange, p.Deleted, p.Policy.RetentionDays, p.Cutoff, p.Hourly, p.Daily))
+	}
+	if deleted > 0 && archiveDir != "" {
+		ui.Success(fmt.Sprintf("Eliminados %d registros antiguos (archivados en %s)", deleted, archiveDir))
+	} else if deleted > 0 {
 		ui.Success(fmt.Sprintf("Eliminados %d registros antiguos", deleted))
-	} else {
+	} else if err == nil {
 		ui.Success("No hay registros antiguos para eliminar")
 	}
 
 	ui.Done()
 }
 
+// planNotifications decides, for every enabled subscriber, whether to send, edit
+// or replace its live message and queues it in the outbox. It runs inside the
+// transaction that stored the quotes, so the decision commits with them.
+func planNotifications(ctx context.Context, tx db.Store, usdtBid float64) error {
+	subs, err := tx.GetSubscribers(ctx)
+	if err != nil {
+		return fmt.Errorf("error leyendo suscriptores: %w", err)
+	}
+	if len(subs) == 0 {
+		ui.Warn("Sin suscriptores habilitados, sin notificaciones nuevas")
+		return nil
+	}
+	summary, err := tx.GetLatestSummary(ctx)
+	if err != nil {
+		return fmt.Errorf("error obteniendo resumen para Telegram: %w", err)
+	}
+
+	for _, sub := range subs {
+		if err := planNotification(ctx, tx, sub, summary, usdtBid); err != nil {
+			return fmt.Errorf("suscriptor %q: %w", sub.Name, err)
+		}
+	}
+	return nil
+}
+
+// skipNotifications records in the audit log that no subscriber was evaluated
+// in this run, and why.
+func skipNotifications(ctx context.Context, tx db.Store, usdtBid float64, reason string) error {
+	subs, err := tx.GetSubscribers(ctx)
+	if err != nil {
+		return fmt.Errorf("error leyendo suscriptores: %w", err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+	summary, err := tx.GetLatestSummary(ctx)
+	if err != nil {
+		return fmt.Errorf("error obteniendo resumen para Telegram: %w", err)
+	}
+	for _, sub := range subs {
+		if err := auditSkipped(ctx, tx, sub, usdtBid, summary[instrument.USDReferencial].Cotizacion, reason); err != nil {
+			return fmt.Errorf("suscriptor %q: %w", sub.Name, err)
+		}
+	}
+	return nil
+}
+
+// auditSkipped records that sub was not notified, with the prices seen and its thresholds.
+func auditSkipped(ctx context.Context, tx db.Store, sub db.Subscriber, usdtBid, usdRef float64, reason string) error {
+	return tx.InsertNotification(ctx, db.Notification{
+		ChatID:            sub.ChatID,
+		Kind:              db.NotifySkipped,
+		USDT:              usdtBid,
+		USDReferencial:    usdRef,
+		Umbral:            sub.Umbral.Float64,
+		UmbralReferencial: sub.UmbralReferencial.Float64,
+		Reason:            reason,
+	})
+}
+
+// planNotification queues the message of one subscriber depending on how far the
+// prices moved from its thresholds.
+func planNotification(ctx context.Context, tx db.Store, sub db.Subscriber, summary map[string]db.Cotizacion, usdtBid float64) error {
+	hasMessage := sub.MessageID.Valid && sub.MessageID.String != ""
+	usdRef := summary[instrument.USDReferencial]
+
+	// Si no hay umbrales definidos, guardamos las referencias actuales y no hacemos nada más.
+	if !sub.Umbral.Valid || !sub.UmbralReferencial.Valid {
+		ui.Info(fmt.Sprintf("Suscriptor %q sin umbrales definidos — guardando referencias y omitiendo notificación.", sub.Name))
+		if err := auditSkipped(ctx, tx, sub, usdtBid, usdRef.Cotizacion, "sin umbrales definidos, se guardan los precios actuales como referencia"); err != nil {
+			return err
+		}
+		return tx.UpdateSubscriber(ctx, sub.ID, db.Today(), sub.MessageID.String, usdtBid, usdRef.Cotizacion)
+	}
+
+	// umbral USDT y USD Referencial: referencias para calcular cambios de precio
+	currentUmbralUSDT := sub.Umbral.Float64
+	currentUmbralRef := sub.UmbralReferencial.Float64
+
+	diffUSDT := usdtBid - currentUmbralUSDT
+	diffRef := usdRef.Cotizacion - currentUmbralRef
+
+	outsideUSDT := math.Abs(diffUSDT) > sub.SpikeThreshold
+	outsideRef := math.Abs(diffRef) > sub.SpikeThreshold
+	isOutside := outsideUSDT || outsideRef
+
+	// diff principal para el mensaje de spike (el mayor)
+	diff := diffUSDT
+	if math.Abs(diffRef) > math.Abs(diffUSDT) {
+		diff = diffRef
+	}
+
+	insts := instrument.Select(sub.Instruments)
+	m := db.OutboxMessage{
+		SubscriberID:      sub.ID,
+		ChatID:            sub.ChatID,
+		Silent:            true,
+		Instruments:       sub.Instruments,
+		USDT:              usdtBid,
+		USDReferencial:    usdRef.Cotizacion,
+		Umbral:            currentUmbralUSDT,
+		UmbralReferencial: currentUmbralRef,
+	}
+	switch {
+	case !hasMessage:
+		m.Kind = db.NotifyDaily
+		m.Text, _ = telegram.FormatDailyMessage(summary, insts)
+	case isOutside:
+		ui.Info(fmt.Sprintf("🚨 %q fuera del umbral: USDT=%.4f(dif=%+.4f) Ref=%.4f(dif=%+.4f)",
+			sub.Name, usdtBid, diffUSDT, usdRef.Cotizacion, diffRef))
+		m.Kind = db.NotifySpike
+		m.Silent = sub.Silent
+		m.Text, _ = telegram.FormatSpikeMessage(summary, insts, currentUmbralUSDT, diff, diff > 0)
+	default:
+		m.Kind = db.NotifyEdit
+		m.MessageID, _ = strconv.Atoi(sub.MessageID.String)
+		m.Text, _ = telegram.FormatDailyMessage(summary, insts)
+	}
+
+	id, err := tx.EnqueueOutbox(ctx, m)
+	if err != nil {
+		return err
+	}
+	ui.Success(fmt.Sprintf("Notificación %d en cola → %s para %q", id, m.Kind, sub.Name))
+	return nil
+}
+
+// sender is the part of telegram.Bot used to deliver notifications; tests replace
+// it with a fake.
+type sender interface {
+	SendMessage(text string, silent bool, replyMarkup tgbotapi.InlineKeyboardMarkup) (int, error)
+	SendPhoto(imagePath, caption string, silent bool, replyMarkup tgbotapi.InlineKeyboardMarkup) (int, error)
+	EditMessage(messageID int, text string, replyMarkup tgbotapi.InlineKeyboardMarkup) error
+	EditPhoto(messageID int, imagePath, caption string, replyMarkup tgbotapi.InlineKeyboardMarkup) error
+}
+
+// deliverOutbox sends one outbox message and then, in a single transaction, marks
+// it as delivered, points the subscriber at the message shown (resetting its
+// thresholds after a spike) and audits every attempt. A failed send is marked
+// failed and leaves the subscriber unchanged. Errors are only warned.
+func deliverOutbox(ctx context.Context, database db.Store, bot sender, m db.OutboxMessage, imagePath string) {
+	btn := telegram.DetailsButton()
+
+	// tryS: envía foto si existe; si falla cae a texto
+	tryS := func(silent bool) (int, error) {
+		if imagePath != "" {
+			id, e := bot.SendPhoto(imagePath, m.Text, silent, btn)
+			if e == nil {
+				return id, nil
+			}
+			ui.Warn(fmt.Sprintf("Foto falló (%v), enviando texto...", e))
+		}
+		return bot.SendMessage(m.Text, silent, btn)
+	}
+
+	// audit: deja constancia del envío/edición con los precios y umbrales evaluados
+	var audits []db.Notification
+	audit := func(kind db.NotificationKind, msgID int, sendErr error) {
+		n := db.Notification{
+			ChatID:            m.ChatID,
+			Kind:              kind,
+			MessageID:         msgID,
+			USDT:              m.USDT,
+			USDReferencial:    m.USDReferencial,
+			Umbral:            m.Umbral,
+			UmbralReferencial: m.UmbralReferencial,
+		}
+		if sendErr != nil {
+			n.Error = sendErr.Error()
+		}
+		audits = append(audits, n)
+	}
+
+	var msgID int
+	var sendErr error
+	if m.Kind == db.NotifyEdit {
+		ui.Info(fmt.Sprintf("Actualizando mensaje existente (id=%d)...", m.MessageID))
+		var editErr error
+		if imagePath != "" {
+			editErr = bot.EditPhoto(m.MessageID, imagePath, m.Text, btn)
+		}
+		if imagePath == "" || editErr != nil {
+			// el mensaje vivo puede ser de texto (envío anterior sin imagen): se
+			// edita como texto antes de reemplazarlo por uno nuevo
+			editErr = bot.EditMessage(m.MessageID, m.Text, btn)
+		}
+		audit(db.NotifyEdit, m.MessageID, editErr)
+		msgID = m.MessageID
+		if editErr != nil {
+			ui.Warn(fmt.Sprintf("No se pudo editar (%v) — enviando nuevo...", editErr))
+			msgID, sendErr = tryS(true)
+			audit(db.NotifyFallback, msgID, sendErr)
+		}
+	} else {
+		msgID, sendErr = tryS(m.Silent)
+		audit(m.Kind, msgID, sendErr)
+	}
+
+	status, errMsg := db.OutboxSent, ""
+	if sendErr != nil {
+		status, errMsg, msgID = db.OutboxFailed, sendErr.Error(), 0
+		ui.Warn(fmt.Sprintf("Error enviando %s: %v", m.Kind, sendErr))
+	} else {
+		ui.Success(fmt.Sprintf("Mensaje %s entregado → msgID=%d", m.Kind, msgID))
+	}
+
+	today := db.Today()
+	err := database.WithTx(ctx, func(tx db.Store) error {
+		if err := tx.CompleteOutbox(ctx, m.ID, status, msgID, errMsg); err != nil {
+			return err
+		}
+		if sendErr == nil {
+			var err error
+			if m.Kind == db.NotifySpike {
+				// spike: nuevo mensaje y umbrales reiniciados a los precios notificados
+				err = tx.UpdateSubscriber(ctx, m.SubscriberID, today, strconv.Itoa(msgID), m.USDT, m.USDReferencial)
+			} else {
+				err = tx.UpdateSubscriberMessageID(ctx, m.SubscriberID, today, strconv.Itoa(msgID))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for _, n := range audits {
+			if err := tx.InsertNotification(ctx, n); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		ui.Warn(fmt.Sprintf("Error registrando entrega de la notificación %d: %v", m.ID, err))
+	}
+}
+
+// findQuote returns the quote for the given moneda and exchange, if present.
+func findQuote(quotes []api.Quote, moneda, exchange string) (api.Quote, bool) {
+	for _, q := range quotes {
+		if q.Moneda == moneda && q.Exchange == exchange {
+			return q, true
+		}
+	}
+	return api.Quote{}, false
+}
+
+// toCotizacion converts a fetched quote into the row stored in cotizaciones.
+func toCotizacion(q api.Quote) db.Cotizacion {
+	c := db.Cotizacion{
+		Moneda:     q.Moneda,
+		Exchange:   q.Exchange,
+		Cotizacion: q.Bid,
+		Purchase:   q.TotalAsk,
+		Ask:        q.Ask,
+		TotalBid:   q.TotalBid,
+	}
+	if st := q.SourceTime(); !st.IsZero() {
+		c.SourceDatetime = db.FormatTime(st)
+	}
+	return c
+}
+
+// sameBCBReading reports whether c repeats the already stored BCB reading prev:
+// same values published for the same day.
+func sameBCBReading(prev, c db.Cotizacion) bool {
+	if prev.Cotizacion != c.Cotizacion || prev.Purchase != c.Purchase {
+		return false
+	}
+	return prev.SourceDatetime == c.SourceDatetime || strings.HasPrefix(prev.Datetime, c.SourceDatetime)
+}
+
 // exitWithError prints a fatal error and terminates the process
 func exitWithError(format string, args ...any) {
 	ui.Fatal(fmt.Sprintf(format, args...))
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"cotizaciones/internal/db"
+	"cotizaciones/internal/instrument"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// fakeSender records the Telegram calls and fails the ones configured.
+type fakeSender struct {
+	nextID                     int
+	sendErr, photoErr, editErr error
+	editPhotoErr               error    // solo EditPhoto, p. ej. el mensaje vivo es de texto
+	sent, photos, edits        []string // textos enviados y editados
+}
+
+func (f *fakeSender) SendMessage(text string, silent bool, _ tgbotapi.InlineKeyboardMarkup) (int, error) {
+	if f.sendErr != nil {
+		return 0, f.sendErr
+	}
+	f.sent = append(f.sent, text)
+	f.nextID++
+	return f.nextID, nil
+}
+
+func (f *fakeSender) SendPhoto(imagePath, caption string, silent bool, _ tgbotapi.InlineKeyboardMarkup) (int, error) {
+	if f.photoErr != nil {
+		return 0, f.photoErr
+	}
+	f.photos = append(f.photos, caption)
+	f.nextID++
+	return f.nextID, nil
+}
+
+func (f *fakeSender) EditMessage(messageID int, text string, _ tgbotapi.InlineKeyboardMarkup) error {
+	if f.editErr != nil {
+		return f.editErr
+	}
+	f.edits = append(f.edits, text)
+	return nil
+}
+
+func (f *fakeSender) EditPhoto(messageID int, imagePath, caption string, _ tgbotapi.InlineKeyboardMarkup) error {
+	if f.editErr != nil {
+		return f.editErr
+	}
+	if f.editPhotoErr != nil {
+		return f.editPhotoErr
+	}
+	f.edits = append(f.edits, caption)
+	return nil
+}
+
+func msgID(id string) sql.NullString   { return sql.NullString{String: id, Valid: id != ""} }
+func umbral(v float64) sql.NullFloat64 { return sql.NullFloat64{Float64: v, Valid: true} }
+
+// seededStore returns a MemStore with USDT at 6.95 and the USD Referencial at 7.18.
+func seededStore(t *testing.T) *db.MemStore {
+	t.Helper()
+	ctx := context.Background()
+	store := db.NewMemStore()
+	for _, c := range []db.Cotizacion{
+		{Moneda: instrument.USDT, Exchange: primaryExchange, Cotizacion: 6.95, Purchase: 7.05},
+		{Moneda: instrument.USDReferencial, Exchange: "bcb", Cotizacion: 7.18, Purchase: 6.97},
+	} {
+		if _, err := store.InsertCotizacion(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func TestPlanNotifications(t *testing.T) {
+	ctx := context.Background()
+	store := seededStore(t)
+	store.Subscribers = []db.Subscriber{
+		{ID: 1, ChatID: "101", Name: "nuevo", Umbral: umbral(6.95), UmbralReferencial: umbral(7.18), SpikeThreshold: 0.2, Enabled: true},
+		{ID: 2, ChatID: "102", Name: "estable", MessageID: msgID("41"), Umbral: umbral(6.90), UmbralReferencial: umbral(7.18), SpikeThreshold: 0.2, Enabled: true},
+		{ID: 3, ChatID: "103", Name: "alerta", MessageID: msgID("42"), Umbral: umbral(6.50), UmbralReferencial: umbral(7.18), SpikeThreshold: 0.2, Enabled: true},
+		{ID: 4, ChatID: "104", Name: "sin umbrales", MessageID: msgID("43"), SpikeThreshold: 0.2, Enabled: true},
+		{ID: 5, ChatID: "105", Name: "pendiente", Umbral: umbral(6.00), UmbralReferencial: umbral(7.18), SpikeThreshold: 0.2, Enabled: true},
+		{ID: 6, ChatID: "106", Name: "deshabilitado", Umbral: umbral(6.00), UmbralReferencial: umbral(7.18), SpikeThreshold: 0.2},
+	}
+	// mensaje de una corrida anterior cuya entrega no quedó registrada
+	runStart := time.Now()
+	store.Now = func() time.Time { return runStart.Add(-time.Hour) }
+	if _, err := store.EnqueueOutbox(ctx, db.OutboxMessage{SubscriberID: 5, ChatID: "105", Kind: db.NotifyDaily, Text: "anterior"}); err != nil {
+		t.Fatal(err)
+	}
+	store.Now = nil
+
+	// como el paso 3: expirar lo anterior y planificar con los precios actuales
+	err := store.WithTx(ctx, func(tx db.Store) error {
+		if n, err := tx.ExpireOutbox(ctx, runStart); err != nil || n != 1 {
+			t.Errorf("expired %d, %v; want 1", n, err)
+		}
+		return planNotifications(ctx, tx, 6.95)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if old := store.Outbox[0]; old.Status != db.OutboxExpired {
+		t.Errorf("stale message is %s, want expired", old.Status)
+	}
+	queued := make(map[int64]db.OutboxMessage)
+	for _, m := range store.Outbox[1:] {
+		if m.Status != db.OutboxPending {
+			t.Errorf("message %d is %s, want pending", m.ID, m.Status)
+		}
+		queued[m.SubscriberID] = m
+	}
+	if len(queued) != 4 {
+		t.Fatalf("queued for subscribers %v, want 1, 2, 3 and 5", queued)
+	}
+	if m := queued[1]; m.Kind != db.NotifyDaily || !m.Silent || m.Text == "" {
+		t.Errorf("nuevo: got %s silent=%v, want a silent daily message", m.Kind, m.Silent)
+	}
+	if m := queued[2]; m.Kind != db.NotifyEdit || m.MessageID != 41 {
+		t.Errorf("estable: got %s of message %d, want edit of 41", m.Kind, m.MessageID)
+	}
+	if m := queued[3]; m.Kind != db.NotifySpike || m.Silent || m.USDT != 6.95 || m.Umbral != 6.50 {
+		t.Errorf("alerta: got %+v, want a loud spike from 6.50 to 6.95", m)
+	}
+	if m := queued[5]; m.Kind != db.NotifyDaily || m.Text == "anterior" {
+		t.Errorf("pendiente: got %s %q, want a daily message planned again", m.Kind, m.Text)
+	}
+
+	// sin umbrales: se guardan las referencias actuales sin notificar
+	s := store.Subscribers[3]
+	if s.Umbral != umbral(6.95) || s.UmbralReferencial != umbral(7.18) || s.MessageID != msgID("43") {
+		t.Errorf("sin umbrales: got %+v, want thresholds 6.95/7.18 and message 43", s)
+	}
+	if len(store.Notifications) != 1 {
+		t.Fatalf("audited %+v, want only the skipped subscriber", store.Notifications)
+	}
+	if n := store.Notifications[0]; n.Kind != db.NotifySkipped || n.ChatID != "104" || n.Reason == "" || n.USDT != 6.95 {
+		t.Errorf("sin umbrales: audited %+v, want skipped with a reason", n)
+	}
+}
+
+func TestSkipNotifications(t *testing.T) {
+	ctx := context.Background()
+	store := seededStore(t)
+	store.Subscribers = []db.Subscriber{
+		{ID: 1, ChatID: "101", Name: "uno", Umbral: umbral(6.50), UmbralReferencial: umbral(7.10), Enabled: true},
+		{ID: 2, ChatID: "102", Name: "dos", Enabled: true},
+		{ID: 3, ChatID: "103", Name: "deshabilitado"},
+	}
+
+	if err := skipNotifications(ctx, store, 7.01, "cotización USDT/binancep2p en cuarentena: salto de 30%"); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.Notifications) != 2 || len(store.Outbox) != 0 {
+		t.Fatalf("audited %+v and queued %+v, want two skipped and nothing queued", store.Notifications, store.Outbox)
+	}
+	for i, chat := range []string{"101", "102"} {
+		n := store.Notifications[i]
+		if n.Kind != db.NotifySkipped || n.ChatID != chat || n.USDT != 7.01 || n.USDReferencial != 7.18 || n.Reason == "" {
+			t.Errorf("audit %d: got %+v, want skipped for chat %s with the prices seen", i, n, chat)
+		}
+	}
+	if n := store.Notifications[0]; n.Umbral != 6.50 || n.UmbralReferencial != 7.10 {
+		t.Errorf("audit 0: thresholds %v/%v, want 6.50/7.10", n.Umbral, n.UmbralReferencial)
+	}
+}
+
+// pendingMessage enqueues m for the first subscriber of store and returns it as delivered by GetPendingOutbox.
+func pendingMessage(t *testing.T, store *db.MemStore, m db.OutboxMessage) db.OutboxMessage {
+	t.Helper()
+	ctx := context.Background()
+	store.Subscribers = []db.Subscriber{
+		{ID: 1, ChatID: "101", Name: "sub", MessageID: msgID("41"), Umbral: umbral(6.50), UmbralReferencial: umbral(7.10), SpikeThreshold: 0.2, Enabled: true},
+	}
+	m.SubscriberID, m.ChatID = 1, "101"
+	m.USDT, m.USDReferencial, m.Umbral, m.UmbralReferencial = 6.95, 7.18, 6.50, 7.10
+	if _, err := store.EnqueueOutbox(ctx, m); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := store.GetPendingOutbox(ctx)
+	if err != nil || len(pending) != 1 {
+		t.Fatalf("pending %v, %v", pending, err)
+	}
+	return pending[0]
+}
+
+func TestDeliverOutbox(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("telegram caído")
+
+	tests := []struct {
+		name       string
+		msg        db.OutboxMessage
+		image      string
+		bot        *fakeSender
+		status     db.OutboxStatus
+		sentID     int
+		subMessage string
+		subUmbral  float64
+		audits     []db.NotificationKind
+		photos     int // mensajes enviados como foto
+		texts      int // mensajes enviados como texto
+	}{
+		{
+			name:       "spike resets thresholds",
+			msg:        db.OutboxMessage{Kind: db.NotifySpike, Text: "spike"},
+			image:      "precios.png",
+			bot:        &fakeSender{nextID: 99},
+			status:     db.OutboxSent,
+			sentID:     100,
+			subMessage: "100",
+			subUmbral:  6.95,
+			audits:     []db.NotificationKind{db.NotifySpike},
+			photos:     1,
+		},
+		{
+			name:       "photo fails, text is sent",
+			msg:        db.OutboxMessage{Kind: db.NotifyDaily, Text: "daily"},
+			image:      "precios.png",
+			bot:        &fakeSender{nextID: 99, photoErr: boom},
+			status:     db.OutboxSent,
+			sentID:     100,
+			subMessage: "100",
+			subUmbral:  6.50,
+			audits:     []db.NotificationKind{db.NotifyDaily},
+			texts:      1,
+		},
+		{
+			name:       "edit in place",
+			msg:        db.OutboxMessage{Kind: db.NotifyEdit, Text: "edit", MessageID: 41},
+			bot:        &fakeSender{},
+			status:     db.OutboxSent,
+			sentID:     41,
+			subMessage: "41",
+			subUmbral:  6.50,
+			audits:     []db.NotificationKind{db.NotifyEdit},
+		},
+		{
+			name:       "live text message edited as text",
+			msg:        db.OutboxMessage{Kind: db.NotifyEdit, Text: "edit", MessageID: 41},
+			image:      "precios.png",
+			bot:        &fakeSender{editPhotoErr: errors.New("there is no media in the message to edit")},
+			status:     db.OutboxSent,
+			sentID:     41,
+			subMessage: "41",
+			subUmbral:  6.50,
+			audits:     []db.NotificationKind{db.NotifyEdit},
+		},
+		{
+			name:       "edit fails, new message",
+			msg:        db.OutboxMessage{Kind: db.NotifyEdit, Text: "edit", MessageID: 41},
+			bot:        &fakeSender{nextID: 99, editErr: boom},
+			status:     db.OutboxSent,
+			sentID:     100,
+			subMessage: "100",
+			subUmbral:  6.50,
+			audits:     []db.NotificationKind{db.NotifyEdit, db.NotifyFallback},
+			texts:      1,
+		},
+		{
+			name:       "send fails, subscriber unchanged",
+			msg:        db.OutboxMessage{Kind: db.NotifySpike, Text: "spike"},
+			bot:        &fakeSender{sendErr: boom},
+			status:     db.OutboxFailed,
+			subMessage: "41",
+			subUmbral:  6.50,
+			audits:     []db.NotificationKind{db.NotifySpike},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := seededStore(t)
+			m := pendingMessage(t, store, tt.msg)
+
+			deliverOutbox(ctx, store, tt.bot, m, tt.image)
+
+			if len(tt.bot.photos) != tt.photos || len(tt.bot.sent) != tt.texts {
+				t.Errorf("sent %d photos and %d texts, want %d and %d", len(tt.bot.photos), len(tt.bot.sent), tt.photos, tt.texts)
+			}
+			got := store.Outbox[0]
+			if got.Status != tt.status || got.SentMessageID != tt.sentID {
+				t.Errorf("outbox %s/%d, want %s/%d", got.Status, got.SentMessageID, tt.status, tt.sentID)
+			}
+			if tt.status == db.OutboxFailed && got.Error == "" {
+				t.Error("failed outbox without error")
+			}
+			sub := store.Subscribers[0]
+			if sub.MessageID.String != tt.subMessage || sub.Umbral.Float64 != tt.subUmbral {
+				t.Errorf("subscriber message %q umbral %v, want %q and %v", sub.MessageID.String, sub.Umbral.Float64, tt.subMessage, tt.subUmbral)
+			}
+			if len(store.Notifications) != len(tt.audits) {
+				t.Fatalf("audited %+v, want %v", store.Notifications, tt.audits)
+			}
+			for i, kind := range tt.audits {
+				if n := store.Notifications[i]; n.Kind != kind || n.ChatID != "101" || n.USDT != 6.95 || n.Umbral != 6.50 {
+					t.Errorf("audit %d: got %+v, want %s for chat 101", i, n, kind)
+				}
+			}
+		})
+	}
+}